@@ -3,117 +3,131 @@ package socketio
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-
-	"github.com/redis/go-redis/v9"
+	"errors"
+	"time"
 )
 
+// ErrRequestTimeout is returned when not all nodes
+// responded to the request before timeout.
+var ErrRequestTimeout = errors.New("request timeout")
+
+// AdapterSender is implemented by types that can emit events
+// to sockets, like `Engine`.
 type AdapterSender interface {
 	Broadcast(ctx context.Context, event string, data any) error
 	EmitForUser(ctx context.Context, userID, event string, data any) error
 }
 
-type AdapterReceiver interface {
-	// ReceivedNew will be called when new event is received.
-	//
-	// userID may be empty if this is a broadcast event.
-	//
-	// Currently all notifications will be processed here,
-	// without difference between user or broadcast notifications or
-	// if user in received event is present on this server.
-	ReceivedNew(ctx context.Context, userID, event string, data json.RawMessage)
+// Adapter keeps track of rooms that sockets joined
+// and delivers packets to sockets, possibly on other nodes.
+//
+// Engine calls `Init` once when it is created, and only
+// after that other methods can be called.
+type Adapter interface {
+	// Init binds adapter to the engine, that
+	// will deliver packets to local sockets.
+	Init(recvr AdapterReceiver)
+
+	// AddSocket adds local socket to rooms.
+	AddSocket(socketID string, rooms ...string)
+	// DelSocket removes local socket from rooms.
+	DelSocket(socketID string, rooms ...string)
+	// RemoveSocket removes local socket from all rooms.
+	RemoveSocket(socketID string)
+	// SocketRooms returns rooms that local socket is in.
+	SocketRooms(socketID string) []string
+
+	// Broadcast sends packet to all sockets that match options.
+	Broadcast(ctx context.Context, packet Packet, opts BroadcastOptions) error
+	// FetchSockets returns sockets that match options.
+	// With `Local` flag only local sockets are returned.
+	FetchSockets(ctx context.Context, opts BroadcastOptions) ([]SocketInfo, error)
+	// AddSockets makes sockets that match options join rooms.
+	AddSockets(ctx context.Context, opts BroadcastOptions, rooms []string) error
+	// DelSockets makes sockets that match options leave rooms.
+	DelSockets(ctx context.Context, opts BroadcastOptions, rooms []string) error
+	// DisconnectSockets disconnects sockets that match options.
+	DisconnectSockets(ctx context.Context, opts BroadcastOptions) error
+	// ServerSideEmit sends event to other nodes.
+	// Event is not delivered to the node that sent it.
+	ServerSideEmit(ctx context.Context, event string, args []json.RawMessage) error
+	// ServerSideEmitWithAck sends event to other nodes and
+	// returns acknowledgements from all of them.
+	ServerSideEmitWithAck(ctx context.Context, event string, args []json.RawMessage) ([]json.RawMessage, error)
+	// Nodes returns live nodes, including this one.
+	Nodes() []NodeInfo
 }
 
-var _ AdapterSender = RedisAdapter{}
-
-type PushData struct {
-	UserID string
-	Event  string
-	Data   json.RawMessage
+// NodeInfo describes node that shares the adapter.
+type NodeInfo struct {
+	// UID is unique id of the node.
+	UID string
+	// LastSeen is time when last heartbeat from the node was received.
+	// It is current time for this node.
+	LastSeen time.Time
+	// Self is set for this node.
+	Self bool
 }
 
-type RedisAdapter struct {
-	r     redis.UniversalClient
-	recvr AdapterReceiver
-
-	codec DataCodec
-
-	eventsChannel string
+// AdapterReceiver is implemented by `Engine`.
+//
+// Its methods should not be used anywhere in the code
+// apart from adapter implementation.
+type AdapterReceiver interface {
+	// SendLocal sends packet to local sockets with provided ids.
+	// Unknown ids are ignored.
+	SendLocal(packet Packet, socketIDs ...string)
+	// LocalSocket returns information about local socket.
+	// Rooms are not filled, as they are tracked by adapter.
+	LocalSocket(socketID string) (SocketInfo, bool)
+	// DisconnectLocal closes local sockets with provided ids.
+	// Unknown ids are ignored.
+	DisconnectLocal(socketIDs ...string)
+	// ReceivedServerSide will be called when server-side event
+	// is received from other node. Returned value is sent back
+	// to that node if it waits for acknowledgements.
+	ReceivedServerSide(ctx context.Context, event string, args []json.RawMessage) json.RawMessage
 }
 
-func NewRedisAdapter(r redis.UniversalClient, recvr AdapterReceiver, codec DataCodec, eventsChannel string) AdapterSender {
-	if codec == nil {
-		codec = NewJSONCodec()
-	}
-
-	if eventsChannel == "" {
-		eventsChannel = "events:websocket"
-	}
-
-	adapter := RedisAdapter{
-		r:     r,
-		recvr: recvr,
-
-		codec: codec,
-
-		eventsChannel: eventsChannel,
-	}
-
-	go adapter.Listen(context.Background())
-
-	return adapter
+// BroadcastOptions selects sockets to deliver packet to.
+type BroadcastOptions struct {
+	// Rooms limits delivery to sockets that are in any of these rooms.
+	// If empty - all sockets are selected.
+	Rooms []string `json:"rooms,omitempty"`
+	// Except excludes sockets that are in any of these rooms.
+	Except []string       `json:"except,omitempty"`
+	Flags  BroadcastFlags `json:"flags,omitempty"`
 }
 
-func (a RedisAdapter) Broadcast(ctx context.Context, event string, data any) error {
-	dataBytes, _ := a.codec.MarashalJSON(data)
-
-	if err := a.send(ctx, PushData{
-		Event: event,
-		Data:  dataBytes,
-	}); err != nil {
-		return fmt.Errorf("broadcast: %w", err)
-	}
-
-	return nil
+// BroadcastFlags modify how packet is delivered.
+type BroadcastFlags struct {
+	// Local limits delivery to sockets connected to this node.
+	Local bool `json:"local,omitempty"`
 }
 
-func (a RedisAdapter) EmitForUser(ctx context.Context, userID string, event string, data any) error {
-	dataBytes, _ := a.codec.MarashalJSON(data)
-
-	if err := a.send(ctx, PushData{
-		UserID: userID,
-		Event:  event,
-		Data:   dataBytes,
-	}); err != nil {
-		return fmt.Errorf("emitForUser: %w", err)
-	}
-
-	return nil
+// SocketInfo is a snapshot of socket state.
+type SocketInfo struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"userId,omitempty"`
+	Rooms     []string        `json:"rooms,omitempty"`
+	Handshake Handshake       `json:"handshake"`
+	Data      json.RawMessage `json:"data,omitempty"`
 }
 
-func (a RedisAdapter) send(ctx context.Context, data PushData) error {
-	bts, _ := json.Marshal(data)
-	resp := a.r.Publish(ctx, a.eventsChannel, bts)
-	if err := resp.Err(); err != nil {
-		return fmt.Errorf("send websocket event from adapter: %w", err)
-	}
-
-	return nil
+// Handshake contains details of socket connection.
+type Handshake struct {
+	// Time is when connection was made.
+	Time time.Time `json:"time"`
+	// Issued is Time in milliseconds since Unix epoch.
+	Issued int64 `json:"issued"`
+	// Address is remote address of the client.
+	Address string `json:"address,omitempty"`
+	// Auth is raw `auth` option value sent by the client.
+	Auth json.RawMessage `json:"auth,omitempty"`
 }
 
-func (a RedisAdapter) Listen(ctx context.Context) error {
-	s := a.r.Subscribe(ctx, a.eventsChannel)
-	defer s.Close()
-
-	evCh := s.Channel()
-	for msg := range evCh {
-		var d PushData
-		if err := json.Unmarshal([]byte(msg.Payload), &d); err != nil {
-			continue
-		}
-
-		a.recvr.ReceivedNew(ctx, d.UserID, d.Event, d.Data)
-	}
-
-	return nil
+// UserRoom returns name of the room that
+// all sockets of the user are joined to.
+func UserRoom(userID string) string {
+	return "user:" + userID
 }
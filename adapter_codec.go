@@ -0,0 +1,262 @@
+package socketio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// envelopeVersion is the first byte of encoded envelope.
+	// Legacy envelopes are JSON objects, that start with '{'.
+	envelopeVersion byte = 1
+	// envelopeHeaderSize is size of version, codec id and flags.
+	envelopeHeaderSize = 3
+	// envelopeFlagCompressed is set if body is compressed with DEFLATE.
+	envelopeFlagCompressed byte = 1 << 0
+	// maxEnvelopeSize limits size of decompressed body.
+	maxEnvelopeSize = 32 << 20
+)
+
+// ErrUnknownEnvelope is returned when message is encoded
+// with envelope version or codec that this node does not support.
+var ErrUnknownEnvelope = errors.New("unknown envelope")
+
+// EnvelopeCodec encodes messages that adapters exchange.
+//
+// Nodes decode messages of all codecs of this package regardless
+// of configured codec, so codec can be changed with rolling upgrade.
+type EnvelopeCodec interface {
+	// ID identifies codec in encoded messages.
+	// IDs below 16 are reserved for codecs of this package.
+	ID() byte
+	Marshal(d PushData) ([]byte, error)
+	Unmarshal(data []byte, d *PushData) error
+}
+
+var (
+	_ EnvelopeCodec = JSONEnvelopeCodec{}
+	_ EnvelopeCodec = MessagePackEnvelopeCodec{}
+	_ EnvelopeCodec = ProtobufEnvelopeCodec{}
+)
+
+// envelopeCodecs are codecs that are always decoded.
+var envelopeCodecs = map[byte]EnvelopeCodec{
+	JSONEnvelopeCodec{}.ID():        JSONEnvelopeCodec{},
+	MessagePackEnvelopeCodec{}.ID(): MessagePackEnvelopeCodec{},
+	ProtobufEnvelopeCodec{}.ID():    ProtobufEnvelopeCodec{},
+}
+
+// JSONEnvelopeCodec encodes messages as JSON.
+// It is the default codec, and uncompressed messages encoded with it
+// are understood by nodes that do not support envelope versions.
+type JSONEnvelopeCodec struct{}
+
+func (JSONEnvelopeCodec) ID() byte { return 1 }
+
+func (JSONEnvelopeCodec) Marshal(d PushData) ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (JSONEnvelopeCodec) Unmarshal(data []byte, d *PushData) error {
+	return json.Unmarshal(data, d)
+}
+
+// MessagePackEnvelopeCodec encodes messages as MessagePack.
+// Raw JSON values, like packet data, are stored as binary strings.
+type MessagePackEnvelopeCodec struct{}
+
+// msgpackPushData is `PushData` with packet encoded as struct,
+// instead of its binary representation.
+type msgpackPushData struct {
+	UID       string
+	Type      PushType
+	RequestID string `json:",omitempty"`
+	Packet    msgpackPacket
+	Opts      BroadcastOptions
+	Rooms     []string `json:",omitempty"`
+	Event     string
+	Args      []json.RawMessage `json:",omitempty"`
+	Data      json.RawMessage   `json:",omitempty"`
+	Sockets   []SocketInfo      `json:",omitempty"`
+}
+
+// msgpackPacket does not implement encoding.BinaryMarshaler.
+type msgpackPacket Packet
+
+func (MessagePackEnvelopeCodec) ID() byte { return 2 }
+
+func (MessagePackEnvelopeCodec) Marshal(d PushData) ([]byte, error) {
+	var b bytes.Buffer
+
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+
+	enc.Reset(&b)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode(msgpackPushData{
+		UID:       d.UID,
+		Type:      d.Type,
+		RequestID: d.RequestID,
+		Packet:    msgpackPacket(d.Packet),
+		Opts:      d.Opts,
+		Rooms:     d.Rooms,
+		Event:     d.Event,
+		Args:      d.Args,
+		Data:      d.Data,
+		Sockets:   d.Sockets,
+	}); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (MessagePackEnvelopeCodec) Unmarshal(data []byte, d *PushData) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+
+	var m msgpackPushData
+	if err := dec.Decode(&m); err != nil {
+		return err
+	}
+
+	*d = PushData{
+		UID:       m.UID,
+		Type:      m.Type,
+		RequestID: m.RequestID,
+		Packet:    Packet(m.Packet),
+		Opts:      m.Opts,
+		Rooms:     m.Rooms,
+		Event:     m.Event,
+		Args:      m.Args,
+		Data:      m.Data,
+		Sockets:   m.Sockets,
+	}
+
+	return nil
+}
+
+// envelope encodes messages with codec, and compresses
+// payloads larger than compressThreshold, if it is positive.
+//
+// Encoded message is version byte, codec id, flags and body.
+// Uncompressed JSON is encoded without header, as legacy message.
+type envelope struct {
+	codec             EnvelopeCodec
+	compressThreshold int
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+func (e envelope) marshal(d PushData) ([]byte, error) {
+	codec := e.codec
+	if codec == nil {
+		codec = JSONEnvelopeCodec{}
+	}
+
+	body, err := codec.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags byte
+	if e.compressThreshold > 0 && len(body) > e.compressThreshold {
+		if compressed, err := compress(body); err == nil && len(compressed) < len(body) {
+			body = compressed
+			flags |= envelopeFlagCompressed
+		}
+	}
+
+	if flags == 0 && codec.ID() == (JSONEnvelopeCodec{}).ID() {
+		return body, nil
+	}
+
+	return append([]byte{envelopeVersion, codec.ID(), flags}, body...), nil
+}
+
+func (e envelope) unmarshal(payload []byte) (PushData, error) {
+	var d PushData
+
+	if len(payload) != 0 && payload[0] == '{' {
+		return d, json.Unmarshal(payload, &d)
+	}
+
+	if len(payload) < envelopeHeaderSize {
+		return d, fmt.Errorf("%w: message is too short", ErrUnknownEnvelope)
+	}
+
+	if payload[0] != envelopeVersion {
+		return d, fmt.Errorf("%w: version %d", ErrUnknownEnvelope, payload[0])
+	}
+
+	codec, ok := envelopeCodecs[payload[1]]
+	if e.codec != nil && e.codec.ID() == payload[1] {
+		codec, ok = e.codec, true
+	}
+
+	if !ok {
+		return d, fmt.Errorf("%w: codec %d", ErrUnknownEnvelope, payload[1])
+	}
+
+	body := payload[envelopeHeaderSize:]
+	if payload[2]&envelopeFlagCompressed != 0 {
+		var err error
+		if body, err = decompress(body); err != nil {
+			return d, fmt.Errorf("decompress message: %w", err)
+		}
+	}
+
+	return d, codec.Unmarshal(body, &d)
+}
+
+func compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+
+	w.Reset(&b)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r, maxEnvelopeSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > maxEnvelopeSize {
+		return nil, fmt.Errorf("message is larger than %d bytes", maxEnvelopeSize)
+	}
+
+	return body, nil
+}
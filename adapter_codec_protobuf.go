@@ -0,0 +1,327 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtobufEnvelopeCodec encodes messages as Protocol Buffers
+// with following schema:
+//
+//	message PushData {
+//	  string uid = 1;
+//	  int32 type = 2;
+//	  string request_id = 3;
+//	  Packet packet = 4;
+//	  BroadcastOptions opts = 5;
+//	  repeated string rooms = 6;
+//	  string event = 7;
+//	  repeated bytes args = 8;
+//	  bytes data = 9;
+//	  repeated SocketInfo sockets = 10;
+//	}
+//
+//	message Packet {
+//	  string type = 1;
+//	  string namespace = 2;
+//	  optional int64 ack_id = 3;
+//	  bytes data = 4;
+//	}
+//
+//	message BroadcastOptions {
+//	  repeated string rooms = 1;
+//	  repeated string except = 2;
+//	  bool local = 3;
+//	}
+//
+//	message SocketInfo {
+//	  string id = 1;
+//	  string user_id = 2;
+//	  repeated string rooms = 3;
+//	  Handshake handshake = 4;
+//	  bytes data = 5;
+//	}
+//
+//	message Handshake {
+//	  int64 time_unix_nano = 1;
+//	  int64 issued = 2;
+//	  string address = 3;
+//	  bytes auth = 4;
+//	}
+type ProtobufEnvelopeCodec struct{}
+
+func (ProtobufEnvelopeCodec) ID() byte { return 3 }
+
+func (ProtobufEnvelopeCodec) Marshal(d PushData) ([]byte, error) {
+	var b []byte
+
+	b = appendString(b, 1, d.UID)
+	b = appendVarint(b, 2, uint64(d.Type))
+	b = appendString(b, 3, d.RequestID)
+	b = appendBytes(b, 4, marshalProtoPacket(d.Packet))
+	b = appendBytes(b, 5, marshalProtoOpts(d.Opts))
+
+	for _, room := range d.Rooms {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, room)
+	}
+
+	b = appendString(b, 7, d.Event)
+
+	for _, arg := range d.Args {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, arg)
+	}
+
+	b = appendBytes(b, 9, d.Data)
+
+	for _, s := range d.Sockets {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtoSocket(s))
+	}
+
+	return b, nil
+}
+
+func (ProtobufEnvelopeCodec) Unmarshal(data []byte, d *PushData) error {
+	return consumeProtoFields(data, func(num protowire.Number, v protoValue) error {
+		switch num {
+		case 1:
+			d.UID = string(v.bytes)
+		case 2:
+			d.Type = PushType(v.varint)
+		case 3:
+			d.RequestID = string(v.bytes)
+		case 4:
+			return unmarshalProtoPacket(v.bytes, &d.Packet)
+		case 5:
+			return unmarshalProtoOpts(v.bytes, &d.Opts)
+		case 6:
+			d.Rooms = append(d.Rooms, string(v.bytes))
+		case 7:
+			d.Event = string(v.bytes)
+		case 8:
+			d.Args = append(d.Args, json.RawMessage(v.bytes))
+		case 9:
+			d.Data = json.RawMessage(v.bytes)
+		case 10:
+			var s SocketInfo
+			if err := unmarshalProtoSocket(v.bytes, &s); err != nil {
+				return err
+			}
+
+			d.Sockets = append(d.Sockets, s)
+		}
+
+		return nil
+	})
+}
+
+func marshalProtoPacket(p Packet) []byte {
+	var b []byte
+
+	b = appendString(b, 1, string(p.Type))
+	b = appendString(b, 2, p.Namespace)
+
+	if p.AckID != nil {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*p.AckID))
+	}
+
+	return appendBytes(b, 4, p.Data)
+}
+
+func unmarshalProtoPacket(data []byte, p *Packet) error {
+	return consumeProtoFields(data, func(num protowire.Number, v protoValue) error {
+		switch num {
+		case 1:
+			p.Type = PacketType(v.bytes)
+		case 2:
+			p.Namespace = string(v.bytes)
+		case 3:
+			id := int(int64(v.varint))
+			p.AckID = &id
+		case 4:
+			p.Data = json.RawMessage(v.bytes)
+		}
+
+		return nil
+	})
+}
+
+func marshalProtoOpts(opts BroadcastOptions) []byte {
+	var b []byte
+
+	for _, room := range opts.Rooms {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, room)
+	}
+
+	for _, room := range opts.Except {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, room)
+	}
+
+	if opts.Flags.Local {
+		b = appendVarint(b, 3, 1)
+	}
+
+	return b
+}
+
+func unmarshalProtoOpts(data []byte, opts *BroadcastOptions) error {
+	return consumeProtoFields(data, func(num protowire.Number, v protoValue) error {
+		switch num {
+		case 1:
+			opts.Rooms = append(opts.Rooms, string(v.bytes))
+		case 2:
+			opts.Except = append(opts.Except, string(v.bytes))
+		case 3:
+			opts.Flags.Local = v.varint != 0
+		}
+
+		return nil
+	})
+}
+
+func marshalProtoSocket(s SocketInfo) []byte {
+	var b []byte
+
+	b = appendString(b, 1, s.ID)
+	b = appendString(b, 2, s.UserID)
+
+	for _, room := range s.Rooms {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, room)
+	}
+
+	var h []byte
+	if !s.Handshake.Time.IsZero() {
+		h = appendVarint(h, 1, uint64(s.Handshake.Time.UnixNano()))
+	}
+
+	h = appendVarint(h, 2, uint64(s.Handshake.Issued))
+	h = appendString(h, 3, s.Handshake.Address)
+	h = appendBytes(h, 4, s.Handshake.Auth)
+
+	b = appendBytes(b, 4, h)
+
+	return appendBytes(b, 5, s.Data)
+}
+
+func unmarshalProtoSocket(data []byte, s *SocketInfo) error {
+	return consumeProtoFields(data, func(num protowire.Number, v protoValue) error {
+		switch num {
+		case 1:
+			s.ID = string(v.bytes)
+		case 2:
+			s.UserID = string(v.bytes)
+		case 3:
+			s.Rooms = append(s.Rooms, string(v.bytes))
+		case 4:
+			return consumeProtoFields(v.bytes, func(num protowire.Number, v protoValue) error {
+				switch num {
+				case 1:
+					s.Handshake.Time = time.Unix(0, int64(v.varint))
+				case 2:
+					s.Handshake.Issued = int64(v.varint)
+				case 3:
+					s.Handshake.Address = string(v.bytes)
+				case 4:
+					s.Handshake.Auth = json.RawMessage(v.bytes)
+				}
+
+				return nil
+			})
+		case 5:
+			s.Data = json.RawMessage(v.bytes)
+		}
+
+		return nil
+	})
+}
+
+// appendString appends non-empty string field.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendString(b, s)
+}
+
+// appendBytes appends non-empty bytes field.
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendBytes(b, v)
+}
+
+// appendVarint appends non-zero varint field.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+
+	return protowire.AppendVarint(b, v)
+}
+
+// protoValue is value of varint or length-delimited field.
+type protoValue struct {
+	varint uint64
+	bytes  []byte
+}
+
+// consumeProtoFields calls fn for every varint and length-delimited
+// field of the message. Fields of other types are skipped.
+func consumeProtoFields(data []byte, fn func(num protowire.Number, v protoValue) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("protobuf tag: %w", protowire.ParseError(n))
+		}
+
+		data = data[n:]
+
+		var v protoValue
+
+		switch typ {
+		case protowire.VarintType:
+			v.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			v.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return fmt.Errorf("protobuf field %d: %w", num, protowire.ParseError(n))
+			}
+
+			data = data[n:]
+
+			continue
+		}
+
+		if n < 0 {
+			return fmt.Errorf("protobuf field %d: %w", num, protowire.ParseError(n))
+		}
+
+		data = data[n:]
+
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
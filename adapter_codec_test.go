@@ -0,0 +1,147 @@
+package socketio_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestEnvelopeCodecs(t *testing.T) {
+	ackID := 0
+	d := socketio.PushData{
+		UID:       "node1",
+		Type:      socketio.PushTypeFetchSocketsResponse,
+		RequestID: "req1",
+		Packet: socketio.Packet{
+			Type:      socketio.PacketTypeEvent,
+			Namespace: socketio.DefaultNamespace,
+			AckID:     &ackID,
+			Data:      json.RawMessage(`["hello",{"a":1}]`),
+		},
+		Opts: socketio.BroadcastOptions{
+			Rooms:  []string{"r1", "r2"},
+			Except: []string{"r3"},
+			Flags:  socketio.BroadcastFlags{Local: true},
+		},
+		Rooms: []string{"r4"},
+		Event: "event",
+		Args:  []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`"a"`)},
+		Data:  json.RawMessage(`{"ok":true}`),
+		Sockets: []socketio.SocketInfo{{
+			ID:     "s1",
+			UserID: "alice",
+			Rooms:  []string{"s1", "user:alice"},
+			Handshake: socketio.Handshake{
+				Time:    time.Unix(1700000000, 123).UTC(),
+				Issued:  1700000000000,
+				Address: "127.0.0.1",
+				Auth:    json.RawMessage(`{"token":"t"}`),
+			},
+			Data: json.RawMessage(`{"name":"Alice"}`),
+		}},
+	}
+
+	codecs := []socketio.EnvelopeCodec{
+		socketio.JSONEnvelopeCodec{},
+		socketio.MessagePackEnvelopeCodec{},
+		socketio.ProtobufEnvelopeCodec{},
+	}
+
+	for _, codec := range codecs {
+		bts, err := codec.Marshal(d)
+		require.NoError(t, err)
+
+		var got socketio.PushData
+		require.NoError(t, codec.Unmarshal(bts, &got))
+
+		require.Len(t, got.Sockets, 1)
+		assert.True(t, d.Sockets[0].Handshake.Time.Equal(got.Sockets[0].Handshake.Time))
+
+		got.Sockets[0].Handshake.Time = d.Sockets[0].Handshake.Time
+		assert.Equal(t, d, got, "codec %d", codec.ID())
+	}
+}
+
+// TestRedisAdapter_MixedCodecs checks that nodes with
+// different codecs understand each other.
+func TestRedisAdapter_MixedCodecs(t *testing.T) {
+	codecs := []socketio.EnvelopeCodec{
+		nil,
+		socketio.MessagePackEnvelopeCodec{},
+		socketio.ProtobufEnvelopeCodec{},
+	}
+
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			srv := miniredis.RunT(t)
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				a := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+				a.Codec = codecs[i%len(codecs)]
+				// Every other node compresses all messages.
+				a.CompressThreshold = i % 2
+
+				adapters[i] = startAdapter(t, a, recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+func TestRedisAdapter_Compression(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	sender := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+	sender.Codec = socketio.MessagePackEnvelopeCodec{}
+	sender.CompressThreshold = 1024
+	startAdapter(t, sender, adaptertest.NewReceiver())
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+	startRedisAdapter(t, srv, recvr).AddSocket("s1", "s1")
+
+	sub := newRedisClient(t, srv).Subscribe(ctx, "events:websocket")
+	t.Cleanup(func() { _ = sub.Close() })
+
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	large := `["` + strings.Repeat("a", 10000) + `"]`
+	require.NoError(t, sender.Broadcast(ctx, socketio.Packet{
+		Type: socketio.PacketTypeEvent,
+		Data: []byte(large),
+	}, socketio.BroadcastOptions{}))
+
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, large, string(recvr.Packets("s1")[0].Data))
+
+	// Heartbeats are small, so only broadcast is compressed.
+	for {
+		msg, err := sub.ReceiveMessage(ctx)
+		require.NoError(t, err)
+
+		// Header is version, codec id and flags.
+		if msg.Payload[0] != 1 || msg.Payload[2]&1 == 0 {
+			continue
+		}
+
+		assert.Less(t, len(msg.Payload), 1024)
+
+		break
+	}
+}
@@ -0,0 +1,262 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+var _ Adapter = &MemoryAdapter{}
+
+// MemoryAdapter delivers packets only to sockets connected
+// to this node. It is used by Engine if no adapter is provided.
+//
+// Sockets of a user are indexed by the room returned from `UserRoom`.
+//
+// It can be embedded by adapters that deliver packets to other nodes
+// to track local rooms and deliver packets to local sockets.
+type MemoryAdapter struct {
+	recvr AdapterReceiver
+	uid   string
+
+	mu sync.RWMutex
+	// rooms maps room to ids of sockets in it.
+	rooms map[string]map[string]struct{}
+	// sids maps socket id to rooms it is in.
+	sids map[string]map[string]struct{}
+
+	// onRoomCreated and onRoomDeleted are called with mu held
+	// when room gets its first socket or loses the last one.
+	onRoomCreated func(room string)
+	onRoomDeleted func(room string)
+}
+
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{
+		uid:   newID(),
+		rooms: make(map[string]map[string]struct{}),
+		sids:  make(map[string]map[string]struct{}),
+	}
+}
+
+func (a *MemoryAdapter) Init(recvr AdapterReceiver) {
+	a.recvr = recvr
+}
+
+func (a *MemoryAdapter) AddSocket(socketID string, rooms ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	socketRooms := a.sids[socketID]
+	if socketRooms == nil {
+		socketRooms = make(map[string]struct{}, len(rooms))
+		a.sids[socketID] = socketRooms
+	}
+
+	for _, room := range rooms {
+		socketRooms[room] = struct{}{}
+
+		sockets := a.rooms[room]
+		if sockets == nil {
+			sockets = make(map[string]struct{})
+			a.rooms[room] = sockets
+
+			if a.onRoomCreated != nil {
+				a.onRoomCreated(room)
+			}
+		}
+
+		sockets[socketID] = struct{}{}
+	}
+}
+
+func (a *MemoryAdapter) DelSocket(socketID string, rooms ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, room := range rooms {
+		a.delUnsafe(socketID, room)
+	}
+}
+
+func (a *MemoryAdapter) RemoveSocket(socketID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for room := range a.sids[socketID] {
+		a.delUnsafe(socketID, room)
+	}
+
+	delete(a.sids, socketID)
+}
+
+func (a *MemoryAdapter) delUnsafe(socketID, room string) {
+	delete(a.sids[socketID], room)
+
+	sockets, ok := a.rooms[room]
+	delete(sockets, socketID)
+
+	if ok && len(sockets) == 0 {
+		delete(a.rooms, room)
+
+		if a.onRoomDeleted != nil {
+			a.onRoomDeleted(room)
+		}
+	}
+}
+
+func (a *MemoryAdapter) SocketRooms(socketID string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return keys(a.sids[socketID])
+}
+
+// RoomSockets returns ids of local sockets in the room.
+func (a *MemoryAdapter) RoomSockets(room string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return keys(a.rooms[room])
+}
+
+// UserSockets returns ids of local sockets of the user.
+func (a *MemoryAdapter) UserSockets(userID string) []string {
+	return a.RoomSockets(UserRoom(userID))
+}
+
+// Rooms returns all rooms that have at least one local socket.
+func (a *MemoryAdapter) Rooms() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return keys(a.rooms)
+}
+
+// hasRooms reports which of the rooms have local sockets.
+func (a *MemoryAdapter) hasRooms(rooms []string) map[string]bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	res := make(map[string]bool, len(rooms))
+	for _, room := range rooms {
+		res[room] = len(a.rooms[room]) != 0
+	}
+
+	return res
+}
+
+// Broadcast sends packet to matching local sockets.
+func (a *MemoryAdapter) Broadcast(_ context.Context, packet Packet, opts BroadcastOptions) error {
+	a.recvr.SendLocal(packet, a.match(opts)...)
+
+	return nil
+}
+
+// FetchSockets returns matching local sockets.
+func (a *MemoryAdapter) FetchSockets(_ context.Context, opts BroadcastOptions) ([]SocketInfo, error) {
+	ids := a.match(opts)
+
+	sockets := make([]SocketInfo, 0, len(ids))
+	for _, id := range ids {
+		info, ok := a.recvr.LocalSocket(id)
+		if !ok {
+			continue
+		}
+
+		info.Rooms = a.SocketRooms(id)
+		sockets = append(sockets, info)
+	}
+
+	return sockets, nil
+}
+
+// AddSockets makes matching local sockets join rooms.
+func (a *MemoryAdapter) AddSockets(_ context.Context, opts BroadcastOptions, rooms []string) error {
+	for _, id := range a.match(opts) {
+		a.AddSocket(id, rooms...)
+	}
+
+	return nil
+}
+
+// DelSockets makes matching local sockets leave rooms.
+func (a *MemoryAdapter) DelSockets(_ context.Context, opts BroadcastOptions, rooms []string) error {
+	for _, id := range a.match(opts) {
+		a.DelSocket(id, rooms...)
+	}
+
+	return nil
+}
+
+// DisconnectSockets disconnects matching local sockets.
+func (a *MemoryAdapter) DisconnectSockets(_ context.Context, opts BroadcastOptions) error {
+	a.recvr.DisconnectLocal(a.match(opts)...)
+
+	return nil
+}
+
+// ServerSideEmit does nothing, as there are no other nodes.
+func (a *MemoryAdapter) ServerSideEmit(context.Context, string, []json.RawMessage) error {
+	return nil
+}
+
+// ServerSideEmitWithAck returns no acknowledgements, as there are no other nodes.
+func (a *MemoryAdapter) ServerSideEmitWithAck(context.Context, string, []json.RawMessage) ([]json.RawMessage, error) {
+	return nil, nil
+}
+
+// Nodes returns only this node.
+func (a *MemoryAdapter) Nodes() []NodeInfo {
+	return []NodeInfo{{UID: a.uid, LastSeen: time.Now(), Self: true}}
+}
+
+// match returns ids of local sockets that match options.
+func (a *MemoryAdapter) match(opts BroadcastOptions) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	except := make(map[string]struct{})
+	for _, room := range opts.Except {
+		for id := range a.rooms[room] {
+			except[id] = struct{}{}
+		}
+	}
+
+	var ids []string
+	add := func(id string) {
+		if _, ok := except[id]; ok {
+			return
+		}
+
+		// Mark as excluded to not add the same socket twice.
+		except[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	if len(opts.Rooms) == 0 {
+		for id := range a.sids {
+			add(id)
+		}
+
+		return ids
+	}
+
+	for _, room := range opts.Rooms {
+		for id := range a.rooms[room] {
+			add(id)
+		}
+	}
+
+	return ids
+}
+
+func keys[K comparable, V any](m map[K]V) []K {
+	res := make([]K, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+
+	return res
+}
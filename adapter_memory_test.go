@@ -0,0 +1,20 @@
+package socketio_test
+
+import (
+	"testing"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestMemoryAdapter(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			a := socketio.NewMemoryAdapter()
+			a.Init(recvrs[0])
+
+			return []socketio.Adapter{a}
+		},
+		SingleNode: true,
+	}.Run(t)
+}
@@ -0,0 +1,746 @@
+package socketio
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ Adapter = &MeshAdapter{}
+
+const (
+	// DefaultMeshDiscoveryInterval is used if `MeshAdapter.DiscoveryInterval` is not set.
+	DefaultMeshDiscoveryInterval = 30 * time.Second
+	// DefaultMeshSendQueueSize is used if `MeshAdapter.SendQueueSize` is not set.
+	DefaultMeshSendQueueSize = 1024
+	// DefaultMeshWriteTimeout is used if `MeshAdapter.WriteTimeout` is not set.
+	DefaultMeshWriteTimeout = 10 * time.Second
+
+	// meshChannel is the only channel of mesh adapter.
+	meshChannel = "mesh"
+	// meshHelloPrefix starts the first frame sent by both sides of connection.
+	meshHelloPrefix = "socketio-mesh/1 "
+	// maxMeshFrameSize limits size of frames received from peers.
+	maxMeshFrameSize = 32 << 20
+)
+
+// errMeshSelf is returned when node dialed itself.
+var errMeshSelf = errors.New("peer is this node")
+
+// PeerDiscovery returns addresses of all nodes.
+// Address of this node can be included, it is skipped.
+type PeerDiscovery func(ctx context.Context) ([]string, error)
+
+// StaticPeers returns discovery with fixed list of addresses.
+func StaticPeers(addrs ...string) PeerDiscovery {
+	return func(context.Context) ([]string, error) {
+		return addrs, nil
+	}
+}
+
+// DNSPeers returns discovery that resolves host to addresses
+// of nodes, for example headless service in Kubernetes.
+// All nodes must listen on the same port.
+func DNSPeers(host, port string) PeerDiscovery {
+	return func(ctx context.Context) ([]string, error) {
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.JoinHostPort(ip, port)
+		}
+
+		return addrs, nil
+	}
+}
+
+// MeshAdapter is RedisAdapter that delivers messages over direct
+// TCP connections between nodes, without a broker.
+//
+// Each node listens for connections from other nodes and dials
+// every discovered peer. Messages are sent over dialed connections
+// and received over accepted ones, so peer lists should be the same on all nodes.
+// Messages sent while peer is not connected are lost.
+//
+// Each peer has queue of `SendQueueSize` messages. If queue is full,
+// sending waits, so slow peer slows down senders. Peer that does not
+// accept message within `WriteTimeout` is disconnected.
+type MeshAdapter struct {
+	*RedisAdapter
+
+	// TLSConfig enables TLS for both accepted and dialed connections.
+	// For mutual TLS it must contain certificate of the node,
+	// RootCAs and ClientCAs, and ClientAuth set to `tls.RequireAndVerifyClientCert`.
+	TLSConfig *tls.Config
+	// DiscoveryInterval is how often peers are discovered again.
+	DiscoveryInterval time.Duration
+	// SendQueueSize is number of messages queued for single peer,
+	// and of received messages queued for handling. Must be set before `Start`.
+	SendQueueSize int
+	// WriteTimeout limits time of writing single message
+	// to the peer, and of handshake.
+	WriteTimeout time.Duration
+
+	listenAddr string
+	discover   PeerDiscovery
+
+	meshMu   sync.Mutex
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	listener net.Listener
+	// peers maps address to peer that is dialed.
+	peers map[string]*meshPeer
+	// self contains addresses that turned out to be this node.
+	self map[string]struct{}
+	// accepted maps connections accepted from other nodes to
+	// uids of these nodes. Uid is empty until handshake is done.
+	accepted map[net.Conn]string
+
+	inbound chan string
+}
+
+// NewMeshAdapter creates adapter that listens on listenAddr
+// and connects to peers returned by discover.
+func NewMeshAdapter(reg prometheus.Registerer, listenAddr string, discover PeerDiscovery) *MeshAdapter {
+	a := &MeshAdapter{
+		RedisAdapter: newRedisAdapter(reg, nil, "mesh", envelopeRedisProtocol{channel: meshChannel}),
+
+		listenAddr: listenAddr,
+		discover:   discover,
+
+		peers:    make(map[string]*meshPeer),
+		self:     make(map[string]struct{}),
+		accepted: make(map[net.Conn]string),
+	}
+
+	a.transport = meshTransport{adapter: a}
+
+	return a
+}
+
+// Start starts listening for and connecting to peers,
+// and receiving messages from them.
+func (a *MeshAdapter) Start(ctx context.Context) error {
+	a.meshMu.Lock()
+
+	if a.cancel != nil {
+		a.meshMu.Unlock()
+		return ErrAdapterStarted
+	}
+
+	listener, err := net.Listen("tcp", a.listenAddr)
+	if err != nil {
+		a.meshMu.Unlock()
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	if a.TLSConfig != nil {
+		listener = tls.NewListener(listener, a.TLSConfig)
+	}
+
+	a.listener = listener
+	a.inbound = make(chan string, a.sendQueueSize())
+
+	var meshCtx context.Context
+	meshCtx, a.cancel = context.WithCancel(ctx)
+
+	a.wg.Add(2)
+	go a.accept(meshCtx, listener)
+	go a.discoverPeers(meshCtx)
+
+	a.meshMu.Unlock()
+
+	if err := a.RedisAdapter.Start(ctx); err != nil {
+		a.stopMesh()
+		return err
+	}
+
+	return nil
+}
+
+// Close notifies peers that this node is closed,
+// stops receiving messages and closes all connections.
+// Adapter can be started again after that.
+func (a *MeshAdapter) Close() error {
+	err := a.RedisAdapter.Close()
+	a.stopMesh()
+
+	return err
+}
+
+// Addr returns address adapter listens on, or nil if it is not started.
+func (a *MeshAdapter) Addr() net.Addr {
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+
+	return a.listener.Addr()
+}
+
+// Peers returns addresses of connected peers, sorted.
+func (a *MeshAdapter) Peers() []string {
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	var addrs []string
+	for addr, peer := range a.peers {
+		if peer.connection() != nil {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+func (a *MeshAdapter) stopMesh() {
+	a.meshMu.Lock()
+
+	if a.cancel == nil {
+		a.meshMu.Unlock()
+		return
+	}
+
+	a.cancel()
+	a.cancel = nil
+
+	_ = a.listener.Close()
+	for conn := range a.accepted {
+		_ = conn.Close()
+	}
+
+	a.meshMu.Unlock()
+
+	a.wg.Wait()
+
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	a.listener = nil
+	a.peers = make(map[string]*meshPeer)
+	a.self = make(map[string]struct{})
+}
+
+// accept accepts connections from other nodes until ctx is done.
+func (a *MeshAdapter) accept(ctx context.Context, listener net.Listener) {
+	defer a.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			a.reportError(fmt.Errorf("accept peer: %w", err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(a.minReconnectBackoff()):
+			}
+
+			continue
+		}
+
+		a.meshMu.Lock()
+		if ctx.Err() != nil {
+			a.meshMu.Unlock()
+			_ = conn.Close()
+
+			return
+		}
+
+		a.accepted[conn] = ""
+		a.wg.Add(1)
+		a.meshMu.Unlock()
+
+		go func() {
+			defer a.wg.Done()
+
+			if err := a.serveAccepted(ctx, conn); err != nil && ctx.Err() == nil {
+				a.reportError(fmt.Errorf("peer %s: %w", conn.RemoteAddr(), err))
+			}
+
+			a.meshMu.Lock()
+			delete(a.accepted, conn)
+			a.meshMu.Unlock()
+
+			_ = conn.Close()
+		}()
+	}
+}
+
+// serveAccepted receives messages from accepted connection.
+func (a *MeshAdapter) serveAccepted(ctx context.Context, conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	_ = conn.SetDeadline(time.Now().Add(a.writeTimeout()))
+
+	uid, err := readMeshHello(r)
+	if err != nil {
+		return err
+	}
+
+	if err := writeMeshFrame(conn, []byte(meshHelloPrefix+a.uid)); err != nil {
+		return err
+	}
+
+	// Dialer will notice that it dialed itself.
+	if uid == a.uid {
+		return nil
+	}
+
+	a.meshMu.Lock()
+	a.accepted[conn] = uid
+	a.meshMu.Unlock()
+
+	_ = conn.SetDeadline(time.Time{})
+
+	for {
+		frame, err := readMeshFrame(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		select {
+		case a.inbound <- string(frame):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// discoverPeers dials discovered peers and
+// stops dialing peers that disappeared.
+func (a *MeshAdapter) discoverPeers(ctx context.Context) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.discoveryInterval())
+	defer ticker.Stop()
+
+	for {
+		addrs, err := a.discover(ctx)
+		if err != nil && ctx.Err() == nil {
+			a.reportError(fmt.Errorf("discover peers: %w", err))
+		}
+
+		if err == nil {
+			a.setPeers(ctx, addrs)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *MeshAdapter) setPeers(ctx context.Context, addrs []string) {
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	found := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		found[addr] = struct{}{}
+
+		if _, ok := a.self[addr]; ok {
+			continue
+		}
+
+		if _, ok := a.peers[addr]; ok {
+			continue
+		}
+
+		peerCtx, cancel := context.WithCancel(ctx)
+		peer := &meshPeer{addr: addr, cancel: cancel}
+		a.peers[addr] = peer
+
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.dialPeer(peerCtx, peer)
+		}()
+	}
+
+	for addr, peer := range a.peers {
+		if _, ok := found[addr]; !ok {
+			peer.cancel()
+			delete(a.peers, addr)
+		}
+	}
+}
+
+// dialPeer keeps connection to the peer and sends
+// messages to it, until ctx is done.
+func (a *MeshAdapter) dialPeer(ctx context.Context, peer *meshPeer) {
+	backoff := a.minReconnectBackoff()
+
+	for ctx.Err() == nil {
+		conn, uid, err := a.dial(ctx, peer.addr)
+		if errors.Is(err, errMeshSelf) {
+			a.meshMu.Lock()
+			a.self[peer.addr] = struct{}{}
+			delete(a.peers, peer.addr)
+			a.meshMu.Unlock()
+
+			return
+		}
+
+		if err == nil {
+			backoff = a.minReconnectBackoff()
+
+			err = a.writeToPeer(ctx, peer, conn, uid)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		a.reportError(fmt.Errorf("peer %s: %w", peer.addr, err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > a.maxReconnectBackoff() {
+			backoff = a.maxReconnectBackoff()
+		}
+	}
+}
+
+// dial connects to the peer and exchanges hello frames.
+// Connection and uid of the peer are returned.
+func (a *MeshAdapter) dial(ctx context.Context, addr string) (net.Conn, string, error) {
+	dialer := net.Dialer{Timeout: a.writeTimeout()}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Deadline covers TLS handshake and exchange of hellos.
+	_ = conn.SetDeadline(time.Now().Add(a.writeTimeout()))
+
+	if a.TLSConfig != nil {
+		cfg := a.TLSConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, "", fmt.Errorf("tls handshake: %w", err)
+		}
+
+		conn = tlsConn
+	}
+
+	if err := writeMeshFrame(conn, []byte(meshHelloPrefix+a.uid)); err != nil {
+		_ = conn.Close()
+		return nil, "", err
+	}
+
+	uid, err := readMeshHello(bufio.NewReader(conn))
+	if err != nil {
+		_ = conn.Close()
+		return nil, "", err
+	}
+
+	if uid == a.uid {
+		_ = conn.Close()
+		return nil, "", errMeshSelf
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, uid, nil
+}
+
+// writeToPeer sends queued messages to the peer
+// until connection fails or ctx is done.
+func (a *MeshAdapter) writeToPeer(ctx context.Context, peer *meshPeer, conn net.Conn, uid string) error {
+	mc := &meshConn{
+		uid:    uid,
+		queue:  make(chan []byte, a.sendQueueSize()),
+		closed: make(chan struct{}),
+	}
+
+	// Heartbeats sent before peer was connected were lost,
+	// so peer learns about this node from initial heartbeat.
+	if _, payload, err := a.proto.encode(a.envelope(), PushData{UID: a.uid, Type: PushTypeInitialHeartbeat}); err == nil {
+		mc.queue <- payload
+	}
+
+	peer.setConnection(mc)
+
+	defer func() {
+		peer.setConnection(nil)
+		_ = conn.Close()
+	}()
+
+	// Peer never writes after hello, reading only
+	// detects that connection was closed.
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, conn)
+		if err == nil {
+			err = io.EOF
+		}
+
+		readErr <- err
+	}()
+
+	defer close(mc.closed)
+
+	w := bufio.NewWriter(conn)
+	for {
+		select {
+		case <-ctx.Done():
+			// Messages queued before close, like notification
+			// that this node is closed, are still sent if possible.
+			_ = conn.SetWriteDeadline(time.Now().Add(a.writeTimeout()))
+			for len(mc.queue) != 0 {
+				if err := writeMeshFrame(w, <-mc.queue); err != nil {
+					break
+				}
+			}
+			_ = w.Flush()
+
+			return ctx.Err()
+		case err := <-readErr:
+			return fmt.Errorf("connection closed: %w", err)
+		case payload := <-mc.queue:
+			_ = conn.SetWriteDeadline(time.Now().Add(a.writeTimeout()))
+
+			if err := writeMeshFrame(w, payload); err != nil {
+				return err
+			}
+
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *MeshAdapter) connections() []*meshConn {
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	conns := make([]*meshConn, 0, len(a.peers))
+	for _, peer := range a.peers {
+		if mc := peer.connection(); mc != nil {
+			conns = append(conns, mc)
+		}
+	}
+
+	return conns
+}
+
+// connectedPeers returns uids of peers that are connected
+// to this node or that this node is connected to.
+func (a *MeshAdapter) connectedPeers() map[string]struct{} {
+	uids := make(map[string]struct{})
+	for _, mc := range a.connections() {
+		uids[mc.uid] = struct{}{}
+	}
+
+	a.meshMu.Lock()
+	defer a.meshMu.Unlock()
+
+	for _, uid := range a.accepted {
+		if uid != "" {
+			uids[uid] = struct{}{}
+		}
+	}
+
+	return uids
+}
+
+func (a *MeshAdapter) discoveryInterval() time.Duration {
+	if a.DiscoveryInterval <= 0 {
+		return DefaultMeshDiscoveryInterval
+	}
+
+	return a.DiscoveryInterval
+}
+
+func (a *MeshAdapter) sendQueueSize() int {
+	if a.SendQueueSize <= 0 {
+		return DefaultMeshSendQueueSize
+	}
+
+	return a.SendQueueSize
+}
+
+func (a *MeshAdapter) writeTimeout() time.Duration {
+	if a.WriteTimeout <= 0 {
+		return DefaultMeshWriteTimeout
+	}
+
+	return a.WriteTimeout
+}
+
+// meshPeer is a peer that node dials.
+type meshPeer struct {
+	addr   string
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// conn is set while peer is connected.
+	conn *meshConn
+}
+
+func (p *meshPeer) connection() *meshConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.conn
+}
+
+func (p *meshPeer) setConnection(mc *meshConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conn = mc
+}
+
+// meshConn is connection to the peer.
+type meshConn struct {
+	// uid is uid of the peer.
+	uid   string
+	queue chan []byte
+	// closed is closed when connection is closed,
+	// so senders stop waiting for the queue.
+	closed chan struct{}
+}
+
+// meshTransport sends messages to all connected peers.
+type meshTransport struct {
+	adapter *MeshAdapter
+}
+
+// publish sends message to all peers, or only to the peer
+// if message is published to its node channel.
+func (t meshTransport) publish(ctx context.Context, channel string, payload []byte) error {
+	uid := strings.TrimPrefix(channel, t.adapter.proto.nodeChannel(""))
+
+	for _, mc := range t.adapter.connections() {
+		if uid != channel && mc.uid != uid {
+			continue
+		}
+
+		select {
+		case mc.queue <- payload:
+		case <-mc.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// numSub returns number of peers connected in either
+// direction and this node.
+func (t meshTransport) numSub(context.Context, string) (int, error) {
+	return len(t.adapter.connectedPeers()) + 1, nil
+}
+
+func (t meshTransport) subscribe(context.Context, []string, []string) (redisSubscription, error) {
+	return meshSubscription{inbound: t.adapter.inbound}, nil
+}
+
+// meshSubscription receives messages from all accepted connections.
+type meshSubscription struct {
+	inbound chan string
+}
+
+func (s meshSubscription) receive(ctx context.Context) (string, string, error) {
+	select {
+	case payload := <-s.inbound:
+		return meshChannel, payload, nil
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+func (s meshSubscription) close() error {
+	return nil
+}
+
+func writeMeshFrame(w io.Writer, payload []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(payload)))
+
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+
+	_, err := w.Write(payload)
+
+	return err
+}
+
+func readMeshFrame(r *bufio.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxMeshFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes is too large", n)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// readMeshHello reads hello frame and returns uid of the peer.
+func readMeshHello(r *bufio.Reader) (string, error) {
+	frame, err := readMeshFrame(r)
+	if err != nil {
+		return "", fmt.Errorf("read hello: %w", err)
+	}
+
+	if !strings.HasPrefix(string(frame), meshHelloPrefix) {
+		return "", errors.New("unexpected hello")
+	}
+
+	return strings.TrimPrefix(string(frame), meshHelloPrefix), nil
+}
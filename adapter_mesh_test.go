@@ -0,0 +1,274 @@
+package socketio_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestMeshAdapter(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			mesh := newMesh()
+			for _, recvr := range recvrs {
+				mesh.start(t, "127.0.0.1:0", nil, recvr)
+			}
+
+			return mesh.wait(t)
+		},
+	}.Run(t)
+}
+
+func TestMeshAdapter_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	other := newTestCA(t)
+
+	mesh := newMesh()
+	recvrs := []*adaptertest.Receiver{adaptertest.NewReceiver(), adaptertest.NewReceiver()}
+	for _, recvr := range recvrs {
+		recvr.Connect(socketio.SocketInfo{ID: "s1"})
+		mesh.start(t, "127.0.0.1:0", ca.tlsConfig(t, ca), recvr).AddSocket("s1", "s1")
+	}
+
+	adapters := mesh.wait(t)
+
+	// Node with certificate issued by other CA is not accepted
+	// by the mesh, and does not accept mesh nodes either.
+	untrusted := mesh.start(t, "127.0.0.1:0", other.tlsConfig(t, ca), adaptertest.NewReceiver())
+
+	require.NoError(t, adapters[0].Broadcast(context.Background(), eventPacket("hello"), socketio.BroadcastOptions{}))
+	require.Eventually(t, func() bool {
+		return len(recvrs[1].Packets("s1")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, untrusted.Peers())
+	for _, a := range adapters {
+		assert.Len(t, a.(*socketio.MeshAdapter).Peers(), 1)
+	}
+}
+
+func TestMeshAdapter_Reconnect(t *testing.T) {
+	mesh := newMesh()
+
+	first := mesh.start(t, "127.0.0.1:0", nil, adaptertest.NewReceiver())
+	second := mesh.start(t, "127.0.0.1:0", nil, adaptertest.NewReceiver())
+	mesh.wait(t)
+
+	addr := second.Addr().String()
+	require.NoError(t, second.Close())
+	require.Eventually(t, func() bool {
+		return len(first.Peers()) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	// Node restarted on the same address is connected again.
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	restarted := socketio.NewMeshAdapter(nil, addr, mesh.discover)
+	restarted.DiscoveryInterval = 20 * time.Millisecond
+	restarted.Init(recvr)
+	require.NoError(t, restarted.Start(context.Background()))
+	t.Cleanup(func() { _ = restarted.Close() })
+	restarted.AddSocket("s1", "s1")
+
+	require.Eventually(t, func() bool {
+		return len(first.Peers()) == 1 && len(restarted.Peers()) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, first.Broadcast(context.Background(), eventPacket("hello"), socketio.BroadcastOptions{}))
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestMeshAdapter_HandshakeTimeout(t *testing.T) {
+	ca := newTestCA(t)
+
+	// Peer that accepts connections, but never responds.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	accepted := make(chan net.Conn, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			select {
+			case accepted <- conn:
+			default:
+				_ = conn.Close()
+			}
+		}
+	}()
+
+	mesh := newMesh()
+	mesh.addrs = append(mesh.addrs, listener.Addr().String())
+
+	a := socketio.NewMeshAdapter(nil, "127.0.0.1:0", mesh.discover)
+	a.TLSConfig = ca.tlsConfig(t, ca)
+	a.WriteTimeout = 50 * time.Millisecond
+	a.MinReconnectBackoff = 10 * time.Millisecond
+	a.MaxReconnectBackoff = 10 * time.Millisecond
+	a.Init(adaptertest.NewReceiver())
+	require.NoError(t, a.Start(context.Background()))
+	t.Cleanup(func() { _ = a.Close() })
+
+	// Handshake times out, so peer is dialed again.
+	for i := 0; i < 2; i++ {
+		select {
+		case conn := <-accepted:
+			t.Cleanup(func() { _ = conn.Close() })
+		case <-time.After(time.Second):
+			t.Fatal("peer was not dialed again")
+		}
+	}
+}
+
+// mesh is a set of mesh adapters that discover each other.
+type mesh struct {
+	mu       sync.Mutex
+	addrs    []string
+	adapters []*socketio.MeshAdapter
+}
+
+func newMesh() *mesh {
+	return &mesh{}
+}
+
+func (m *mesh) discover(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.addrs...), nil
+}
+
+// start starts adapter that will be closed when test ends.
+func (m *mesh) start(t *testing.T, addr string, cfg *tls.Config, recvr socketio.AdapterReceiver) *socketio.MeshAdapter {
+	t.Helper()
+
+	a := socketio.NewMeshAdapter(nil, addr, m.discover)
+	a.TLSConfig = cfg
+	a.DiscoveryInterval = 20 * time.Millisecond
+	a.MinReconnectBackoff = 10 * time.Millisecond
+	a.MaxReconnectBackoff = 50 * time.Millisecond
+	a.RequestTimeout = time.Second
+	a.Init(recvr)
+
+	require.NoError(t, a.Start(context.Background()))
+	t.Cleanup(func() { _ = a.Close() })
+
+	m.mu.Lock()
+	m.addrs = append(m.addrs, a.Addr().String())
+	m.adapters = append(m.adapters, a)
+	m.mu.Unlock()
+
+	return a
+}
+
+// wait waits until all adapters are connected to each other.
+func (m *mesh) wait(t *testing.T) []socketio.Adapter {
+	t.Helper()
+
+	res := make([]socketio.Adapter, len(m.adapters))
+	for i, a := range m.adapters {
+		a := a
+		require.Eventually(t, func() bool {
+			return len(a.Peers()) == len(m.adapters)-1
+		}, 2*time.Second, 5*time.Millisecond)
+
+		res[i] = a
+	}
+
+	return res
+}
+
+func eventPacket(event string) socketio.Packet {
+	return socketio.Packet{
+		Type:      socketio.PacketTypeEvent,
+		Namespace: socketio.DefaultNamespace,
+		Data:      []byte(`["` + event + `"]`),
+	}
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+// tlsConfig returns mutual TLS config with node certificate
+// issued by ca, that trusts certificates issued by trusted.
+func (ca testCA) tlsConfig(t *testing.T, trusted testCA) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(trusted.cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
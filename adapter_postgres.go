@@ -0,0 +1,284 @@
+package socketio
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ Adapter = &PostgresAdapter{}
+
+const (
+	// DefaultPostgresAttachmentsTable is used if table is not provided to `NewPostgresAdapter`.
+	DefaultPostgresAttachmentsTable = "socketio_attachments"
+	// DefaultAttachmentsCleanupInterval is used if `PostgresAdapter.CleanupInterval` is not set.
+	DefaultAttachmentsCleanupInterval = 30 * time.Second
+	// maxNotifyPayload is the largest payload NOTIFY accepts.
+	maxNotifyPayload = 7999
+	// attachmentPrefix starts notification that refers to attachment.
+	// Encoded messages can not start with it.
+	attachmentPrefix = "attachment:"
+	// base64Prefix starts notification with binary message, as
+	// notifications are text that can not contain zero bytes.
+	base64Prefix = "base64:"
+)
+
+// PostgresAdapter is RedisAdapter that delivers messages
+// with PostgreSQL LISTEN/NOTIFY instead of Redis Pub/Sub.
+//
+// Payloads larger than NOTIFY allows are stored in attachments table,
+// and notification contains only id of the attachment.
+// Attachments older than `CleanupInterval` are deleted periodically.
+//
+// Number of nodes is known from heartbeats only, so requests
+// to other nodes may wait for `RequestTimeout` right after start.
+type PostgresAdapter struct {
+	*RedisAdapter
+
+	// CleanupInterval is how often attachments are deleted,
+	// and how long they are kept.
+	CleanupInterval time.Duration
+
+	pool  *pgxpool.Pool
+	table string
+
+	cleanupMu     sync.Mutex
+	cleanupCancel context.CancelFunc
+	cleanupDone   chan struct{}
+}
+
+// NewPostgresAdapter creates adapter that notifies other nodes on the channel.
+// Channel can be shared by adapters created with the same arguments only.
+//
+// Attachments table is created when adapter starts, if it does not exist.
+func NewPostgresAdapter(reg prometheus.Registerer, pool *pgxpool.Pool, channel, table string) *PostgresAdapter {
+	if channel == "" {
+		channel = "events:websocket"
+	}
+
+	if table == "" {
+		table = DefaultPostgresAttachmentsTable
+	}
+
+	a := &PostgresAdapter{
+		RedisAdapter: newRedisAdapter(reg, nil, "postgres", envelopeRedisProtocol{channel: channel}),
+
+		pool:  pool,
+		table: pgx.Identifier{table}.Sanitize(),
+	}
+
+	a.transport = &postgresTransport{adapter: a}
+
+	return a
+}
+
+// Start creates attachments table, starts receiving
+// messages from other nodes and cleaning up attachments.
+func (a *PostgresAdapter) Start(ctx context.Context) error {
+	if _, err := a.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+a.table+` (
+		id         bigserial PRIMARY KEY,
+		created_at timestamptz NOT NULL DEFAULT now(),
+		payload    bytea NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create attachments table: %w", err)
+	}
+
+	if err := a.RedisAdapter.Start(ctx); err != nil {
+		return err
+	}
+
+	a.cleanupMu.Lock()
+	defer a.cleanupMu.Unlock()
+
+	ctx, a.cleanupCancel = context.WithCancel(ctx)
+	a.cleanupDone = make(chan struct{})
+
+	go a.cleanup(ctx)
+
+	return nil
+}
+
+// Close stops receiving messages and cleaning up attachments.
+func (a *PostgresAdapter) Close() error {
+	err := a.RedisAdapter.Close()
+
+	a.cleanupMu.Lock()
+	defer a.cleanupMu.Unlock()
+
+	if a.cleanupCancel != nil {
+		a.cleanupCancel()
+		<-a.cleanupDone
+
+		a.cleanupCancel = nil
+	}
+
+	return err
+}
+
+// cleanup deletes old attachments until ctx is done.
+func (a *PostgresAdapter) cleanup(ctx context.Context) {
+	defer close(a.cleanupDone)
+
+	ticker := time.NewTicker(a.cleanupInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := a.pool.Exec(ctx,
+				`DELETE FROM `+a.table+` WHERE created_at < now() - $1 * interval '1 millisecond'`,
+				a.cleanupInterval().Milliseconds(),
+			); err != nil && ctx.Err() == nil {
+				a.reportError(fmt.Errorf("clean up attachments: %w", err))
+			}
+		}
+	}
+}
+
+func (a *PostgresAdapter) cleanupInterval() time.Duration {
+	if a.CleanupInterval <= 0 {
+		return DefaultAttachmentsCleanupInterval
+	}
+
+	return a.CleanupInterval
+}
+
+// postgresTransport uses LISTEN/NOTIFY as channels.
+type postgresTransport struct {
+	adapter *PostgresAdapter
+}
+
+func (t *postgresTransport) publish(ctx context.Context, channel string, payload []byte) error {
+	notification := string(payload)
+	if !utf8.Valid(payload) || bytes.IndexByte(payload, 0) >= 0 {
+		notification = base64Prefix + base64.StdEncoding.EncodeToString(payload)
+	}
+
+	if len(notification) > maxNotifyPayload {
+		var id int64
+		if err := t.adapter.pool.QueryRow(ctx,
+			`INSERT INTO `+t.adapter.table+` (payload) VALUES ($1) RETURNING id`, payload,
+		).Scan(&id); err != nil {
+			return fmt.Errorf("store attachment: %w", err)
+		}
+
+		notification = attachmentPrefix + strconv.FormatInt(id, 10)
+	}
+
+	_, err := t.adapter.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, notification)
+
+	return err
+}
+
+// numSub returns -1, as listeners of other sessions are not visible.
+func (t *postgresTransport) numSub(context.Context, string) (int, error) {
+	return -1, nil
+}
+
+func (t *postgresTransport) subscribe(ctx context.Context, channels, patterns []string) (redisSubscription, error) {
+	if len(patterns) != 0 {
+		return nil, errors.New("patterns are not supported by LISTEN")
+	}
+
+	pooled, err := t.adapter.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connection is never returned to the pool, as it keeps listening.
+	conn := pooled.Hijack()
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			_ = conn.Close(context.Background())
+			return nil, err
+		}
+	}
+
+	return &postgresSubscription{t: t, conn: conn}, nil
+}
+
+type postgresSubscription struct {
+	t *postgresTransport
+
+	// mu is held while waiting for notification,
+	// as connection can not be used concurrently.
+	mu   sync.Mutex
+	conn *pgx.Conn
+}
+
+func (s *postgresSubscription) receive(ctx context.Context) (string, string, error) {
+	for {
+		s.mu.Lock()
+		notification, err := s.conn.WaitForNotification(ctx)
+		s.mu.Unlock()
+
+		if err != nil {
+			return "", "", err
+		}
+
+		if strings.HasPrefix(notification.Payload, base64Prefix) {
+			payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(notification.Payload, base64Prefix))
+			if err != nil {
+				s.t.adapter.metrics.Malformed.Inc()
+				s.t.adapter.reportError(fmt.Errorf("decode notification: %w", err))
+
+				continue
+			}
+
+			return notification.Channel, string(payload), nil
+		}
+
+		if !strings.HasPrefix(notification.Payload, attachmentPrefix) {
+			return notification.Channel, notification.Payload, nil
+		}
+
+		// Attachment that can not be loaded does not
+		// break subscription, only its message is lost.
+		payload, err := s.loadAttachment(ctx, strings.TrimPrefix(notification.Payload, attachmentPrefix))
+		if err != nil {
+			s.t.adapter.metrics.Malformed.Inc()
+			s.t.adapter.reportError(err)
+
+			continue
+		}
+
+		return notification.Channel, payload, nil
+	}
+}
+
+func (s *postgresSubscription) loadAttachment(ctx context.Context, rawID string) (string, error) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("attachment id %q: %w", rawID, err)
+	}
+
+	var payload []byte
+	if err := s.t.adapter.pool.QueryRow(ctx,
+		`SELECT payload FROM `+s.t.adapter.table+` WHERE id = $1`, id,
+	).Scan(&payload); err != nil {
+		return "", fmt.Errorf("load attachment %d: %w", id, err)
+	}
+
+	return string(payload), nil
+}
+
+func (s *postgresSubscription) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn.Close(context.Background())
+}
@@ -0,0 +1,747 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ Adapter = &RedisAdapter{}
+
+const (
+	// DefaultMinReconnectBackoff is used if `RedisAdapter.MinReconnectBackoff` is not set.
+	DefaultMinReconnectBackoff = 100 * time.Millisecond
+	// DefaultMaxReconnectBackoff is used if `RedisAdapter.MaxReconnectBackoff` is not set.
+	DefaultMaxReconnectBackoff = 10 * time.Second
+	// DefaultRequestTimeout is used if `RedisAdapter.RequestTimeout` is not set.
+	DefaultRequestTimeout = 5 * time.Second
+)
+
+// ErrAdapterStarted is returned when adapter is started more than once.
+var ErrAdapterStarted = errors.New("adapter is already started")
+
+type PushType int
+
+const (
+	PushTypeBroadcast PushType = iota
+	PushTypeServerSideEmit
+	PushTypeSocketsJoin
+	PushTypeSocketsLeave
+	PushTypeDisconnectSockets
+	PushTypeFetchSockets
+	PushTypeFetchSocketsResponse
+	PushTypeServerSideEmitResponse
+	PushTypeInitialHeartbeat
+	PushTypeHeartbeat
+	PushTypeNodeClose
+	PushTypeUserRooms
+	PushTypeUserRoomsAdded
+)
+
+// PushData is a message published by RedisAdapter.
+type PushData struct {
+	// UID is id of the node that published the message.
+	UID  string
+	Type PushType
+
+	// RequestID is set for requests and responses to them.
+	RequestID string `json:",omitempty"`
+
+	// Packet and Opts are set for broadcasts.
+	// Opts are also set for joining, leaving rooms,
+	// disconnecting and fetching sockets.
+	Packet Packet
+	Opts   BroadcastOptions
+
+	// Rooms are rooms that matching sockets join or leave.
+	// For user rooms messages they are user rooms of the node.
+	Rooms []string `json:",omitempty"`
+
+	// Event and Args are set for server-side events.
+	Event string
+	Args  []json.RawMessage `json:",omitempty"`
+	// Data is set for acknowledgements of server-side events.
+	Data json.RawMessage `json:",omitempty"`
+
+	// Sockets are set for responses to fetch sockets requests.
+	Sockets []SocketInfo `json:",omitempty"`
+}
+
+// RedisAdapter delivers packets to sockets on all nodes
+// that are subscribed to the same Redis channels.
+//
+// Local rooms are tracked by embedded MemoryAdapter.
+// Each adapter has unique uid that is embedded in published messages,
+// so that adapter can skip messages that it published itself.
+//
+// Adapter does not receive messages from other nodes
+// until it is started with `Start`.
+type RedisAdapter struct {
+	*MemoryAdapter
+
+	uid       string
+	proto     redisProtocol
+	transport redisTransport
+
+	// OnError is called when subscription fails or
+	// malformed message is received.
+	OnError func(err error)
+	// MinReconnectBackoff and MaxReconnectBackoff define delays
+	// between resubscribe attempts. Delay doubles after each failed attempt.
+	MinReconnectBackoff time.Duration
+	MaxReconnectBackoff time.Duration
+	// RequestTimeout is how long requests to other nodes
+	// wait for responses.
+	RequestTimeout time.Duration
+	// HeartbeatInterval is how often node announces itself to other nodes.
+	HeartbeatInterval time.Duration
+	// HeartbeatTimeout is how long node is considered alive after
+	// its last heartbeat. Defaults to three heartbeat intervals.
+	HeartbeatTimeout time.Duration
+	// Codec encodes published messages. Defaults to `JSONEnvelopeCodec`.
+	// Messages of all codecs of this package are decoded, so codec
+	// can be changed once all nodes are upgraded to support it.
+	// Ignored by adapters that implement protocol of other library.
+	Codec EnvelopeCodec
+	// CompressThreshold is size of encoded message above which
+	// message is compressed. Zero disables compression.
+	CompressThreshold int
+	// RouteUsers makes nodes share which users are connected to them,
+	// so that packets for users are published only to channels of nodes
+	// that have their sockets. Packets for users that no node reported
+	// are published to all nodes. Must be set before `Start`.
+	RouteUsers bool
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	healthy int32
+
+	// sub is current subscription. It is closed when adapter
+	// is stopped, as receiving from it does not respect context.
+	subMu sync.Mutex
+	sub   redisSubscription
+
+	handlersMu sync.Mutex
+	// handlers maps uid of other node to server-side
+	// events of it that are waiting to be handled.
+	handlers map[string][]func()
+
+	requestsMu sync.Mutex
+	// requests maps id of pending request to channel
+	// that receives responses to it.
+	requests map[string]chan PushData
+
+	nodesMu sync.Mutex
+	// nodes maps uid of other node to time of its last heartbeat.
+	nodes map[string]time.Time
+	// nodeRooms maps uid of other node to its user rooms,
+	// and roomNodes maps user room to uids of nodes that have it.
+	nodeRooms map[string]map[string]struct{}
+	roomNodes map[string]map[string]struct{}
+
+	// announceMu orders announcements of user rooms.
+	announceMu sync.Mutex
+	addedMu    sync.Mutex
+	// addedRooms are user rooms created since they were last announced.
+	addedRooms map[string]struct{}
+	roomsAdded chan struct{}
+
+	metrics *AdapterMetrics
+}
+
+func NewRedisAdapter(reg prometheus.Registerer, r redis.UniversalClient, eventsChannel string) *RedisAdapter {
+	if eventsChannel == "" {
+		eventsChannel = "events:websocket"
+	}
+
+	return newRedisAdapter(reg, r, "redis", envelopeRedisProtocol{channel: eventsChannel})
+}
+
+// newRedisAdapter creates adapter that uses Redis Pub/Sub.
+// Name is used as metrics label.
+func newRedisAdapter(reg prometheus.Registerer, r redis.UniversalClient, name string, proto redisProtocol) *RedisAdapter {
+	a := &RedisAdapter{
+		MemoryAdapter: NewMemoryAdapter(),
+
+		uid:       newID(),
+		proto:     proto,
+		transport: pubSubTransport{r: r},
+		handlers:  make(map[string][]func()),
+		requests:  make(map[string]chan PushData),
+		nodes:     make(map[string]time.Time),
+		nodeRooms: make(map[string]map[string]struct{}),
+		roomNodes: make(map[string]map[string]struct{}),
+
+		addedRooms: make(map[string]struct{}),
+		roomsAdded: make(chan struct{}, 1),
+
+		metrics: NewAdapterMetrics(reg, name),
+	}
+
+	a.MemoryAdapter.onRoomCreated = a.onRoomCreated
+
+	return a
+}
+
+// UID returns unique id of this node.
+func (a *RedisAdapter) UID() string {
+	return a.uid
+}
+
+// Start subscribes to adapter channels and starts receiving
+// messages from other nodes in background, until ctx is done or
+// adapter is closed.
+//
+// Error is returned if initial subscription fails.
+// After that adapter resubscribes automatically if subscription breaks.
+func (a *RedisAdapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cancel != nil {
+		return ErrAdapterStarted
+	}
+
+	sub, err := a.subscribe(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, a.cancel = context.WithCancel(ctx)
+	a.done = make(chan struct{})
+
+	go a.run(ctx, sub)
+
+	return nil
+}
+
+// Close stops receiving messages and waits for
+// background goroutine to exit. Adapter can be started again after that.
+func (a *RedisAdapter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cancel == nil {
+		return nil
+	}
+
+	a.cancel()
+	<-a.done
+
+	a.cancel = nil
+
+	return nil
+}
+
+// Healthy reports whether adapter is currently subscribed.
+func (a *RedisAdapter) Healthy() bool {
+	return atomic.LoadInt32(&a.healthy) == 1
+}
+
+// Broadcast delivers packet to local sockets and
+// publishes it to other nodes.
+func (a *RedisAdapter) Broadcast(ctx context.Context, packet Packet, opts BroadcastOptions) error {
+	_ = a.MemoryAdapter.Broadcast(ctx, packet, opts)
+
+	if opts.Flags.Local {
+		return nil
+	}
+
+	d := PushData{
+		Type:   PushTypeBroadcast,
+		Packet: packet,
+		Opts:   opts,
+	}
+
+	channels, ok := a.routeUsers(opts)
+	if !ok {
+		if err := a.send(ctx, d); err != nil {
+			return fmt.Errorf("broadcast: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, channel := range channels {
+		if err := a.sendTo(ctx, channel, d); err != nil {
+			return fmt.Errorf("broadcast: %w", err)
+		}
+	}
+
+	a.metrics.Routed.Inc()
+
+	return nil
+}
+
+func (a *RedisAdapter) ServerSideEmit(ctx context.Context, event string, args []json.RawMessage) error {
+	if err := a.send(ctx, PushData{
+		Type:  PushTypeServerSideEmit,
+		Event: event,
+		Args:  args,
+	}); err != nil {
+		return fmt.Errorf("serverSideEmit: %w", err)
+	}
+
+	return nil
+}
+
+// ServerSideEmitWithAck sends event to other nodes and returns their acknowledgements.
+//
+// If not all nodes responded before `RequestTimeout`, acknowledgements
+// that were received are returned with error that wraps `ErrRequestTimeout`.
+func (a *RedisAdapter) ServerSideEmitWithAck(ctx context.Context, event string, args []json.RawMessage) ([]json.RawMessage, error) {
+	responses, err := a.request(ctx, PushData{
+		Type:  PushTypeServerSideEmit,
+		Event: event,
+		Args:  args,
+	})
+
+	acks := make([]json.RawMessage, len(responses))
+	for i, resp := range responses {
+		acks[i] = resp.Data
+	}
+
+	if err != nil {
+		return acks, fmt.Errorf("serverSideEmitWithAck: %w", err)
+	}
+
+	return acks, nil
+}
+
+// FetchSockets returns matching sockets from all nodes.
+//
+// If not all nodes responded before `RequestTimeout`,
+// sockets that were received are returned with error that wraps `ErrRequestTimeout`.
+func (a *RedisAdapter) FetchSockets(ctx context.Context, opts BroadcastOptions) ([]SocketInfo, error) {
+	sockets, _ := a.MemoryAdapter.FetchSockets(ctx, opts)
+	if opts.Flags.Local {
+		return sockets, nil
+	}
+
+	responses, err := a.request(ctx, PushData{
+		Type: PushTypeFetchSockets,
+		Opts: opts,
+	})
+
+	for _, resp := range responses {
+		sockets = append(sockets, resp.Sockets...)
+	}
+
+	if err != nil {
+		return sockets, fmt.Errorf("fetchSockets: %w", err)
+	}
+
+	return sockets, nil
+}
+
+// request sends request to other nodes and waits for their responses.
+//
+// Number of nodes is taken from heartbeats, so other subscribers of
+// the channel are not waited for. Until other nodes are known, it is
+// taken from number of subscribers. If protocol allows nodes that do not
+// send heartbeats, the larger of both numbers is used.
+// If transport can not count subscribers,
+// responses are collected until `RequestTimeout`.
+// Otherwise error that wraps `ErrRequestTimeout` is returned together
+// with received responses if not all nodes responded in time.
+func (a *RedisAdapter) request(ctx context.Context, d PushData) ([]PushData, error) {
+	// Expected number of responses is unknown if it is negative.
+	expected := a.liveNodes()
+	if expected == 0 || a.proto.foreignNodes() {
+		numSub, err := a.transport.numSub(ctx, a.proto.requestChannel())
+		if err != nil {
+			return nil, fmt.Errorf("count nodes: %w", err)
+		}
+
+		switch {
+		case numSub < 0:
+			if expected == 0 {
+				expected = numSub
+			}
+		// This node is subscribed as well.
+		case numSub-1 > expected:
+			expected = numSub - 1
+		}
+	}
+
+	if expected == 0 {
+		return nil, nil
+	}
+
+	size := expected
+	if size < 16 {
+		size = 16
+	}
+
+	d.RequestID = newID()
+	responses := make(chan PushData, size)
+
+	a.requestsMu.Lock()
+	a.requests[d.RequestID] = responses
+	a.requestsMu.Unlock()
+
+	defer func() {
+		a.requestsMu.Lock()
+		delete(a.requests, d.RequestID)
+		a.requestsMu.Unlock()
+	}()
+
+	if err := a.send(ctx, d); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(a.requestTimeout())
+	defer timer.Stop()
+
+	var res []PushData
+	for expected < 0 || len(res) < expected {
+		select {
+		case resp := <-responses:
+			res = append(res, resp)
+		case <-timer.C:
+			if expected < 0 {
+				return res, nil
+			}
+
+			return res, fmt.Errorf("%w: %d of %d nodes responded", ErrRequestTimeout, len(res), expected)
+		case <-ctx.Done():
+			return res, ctx.Err()
+		}
+	}
+
+	return res, nil
+}
+
+// AddSockets makes matching sockets on all nodes join rooms.
+func (a *RedisAdapter) AddSockets(ctx context.Context, opts BroadcastOptions, rooms []string) error {
+	return a.applyAndSend(ctx, PushData{Type: PushTypeSocketsJoin, Opts: opts, Rooms: rooms})
+}
+
+// DelSockets makes matching sockets on all nodes leave rooms.
+func (a *RedisAdapter) DelSockets(ctx context.Context, opts BroadcastOptions, rooms []string) error {
+	return a.applyAndSend(ctx, PushData{Type: PushTypeSocketsLeave, Opts: opts, Rooms: rooms})
+}
+
+// DisconnectSockets disconnects matching sockets on all nodes.
+func (a *RedisAdapter) DisconnectSockets(ctx context.Context, opts BroadcastOptions) error {
+	return a.applyAndSend(ctx, PushData{Type: PushTypeDisconnectSockets, Opts: opts})
+}
+
+// applyAndSend applies command to local sockets and
+// sends it to other nodes, unless it is local.
+func (a *RedisAdapter) applyAndSend(ctx context.Context, d PushData) error {
+	a.apply(ctx, d)
+
+	if d.Opts.Flags.Local {
+		return nil
+	}
+
+	return a.send(ctx, d)
+}
+
+// apply applies command to local sockets.
+func (a *RedisAdapter) apply(ctx context.Context, d PushData) {
+	switch d.Type {
+	case PushTypeSocketsJoin:
+		_ = a.MemoryAdapter.AddSockets(ctx, d.Opts, d.Rooms)
+	case PushTypeSocketsLeave:
+		_ = a.MemoryAdapter.DelSockets(ctx, d.Opts, d.Rooms)
+	case PushTypeDisconnectSockets:
+		_ = a.MemoryAdapter.DisconnectSockets(ctx, d.Opts)
+	}
+}
+
+func (a *RedisAdapter) send(ctx context.Context, data PushData) error {
+	return a.sendTo(ctx, "", data)
+}
+
+// sendTo publishes message to channel, or to
+// channel selected by protocol if channel is empty.
+func (a *RedisAdapter) sendTo(ctx context.Context, channel string, data PushData) error {
+	data.UID = a.uid
+
+	protoChannel, bts, err := a.proto.encode(a.envelope(), data)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+
+	if channel == "" {
+		channel = protoChannel
+	}
+
+	if err := a.transport.publish(ctx, channel, bts); err != nil {
+		return fmt.Errorf("send websocket event from adapter: %w", err)
+	}
+
+	a.metrics.Published.Inc()
+
+	return nil
+}
+
+// subscribe subscribes to adapter channels and
+// waits for subscriptions to be confirmed.
+func (a *RedisAdapter) subscribe(ctx context.Context) (redisSubscription, error) {
+	channels, patterns := a.proto.channels()
+	if channel := a.proto.nodeChannel(a.uid); a.RouteUsers && channel != "" {
+		channels = append(channels, channel)
+	}
+
+	sub, err := a.transport.subscribe(ctx, channels, patterns)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %q: %w", append(channels, patterns...), err)
+	}
+
+	a.setHealthy(true)
+
+	return sub, nil
+}
+
+// run receives messages and resubscribes with backoff
+// until ctx is done.
+func (a *RedisAdapter) run(ctx context.Context, sub redisSubscription) {
+	defer close(a.done)
+	defer a.setHealthy(false)
+
+	heartbeatDone := make(chan struct{})
+	defer func() { <-heartbeatDone }()
+
+	go func() {
+		defer close(heartbeatDone)
+		a.heartbeat(ctx)
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		a.subMu.Lock()
+		defer a.subMu.Unlock()
+
+		if a.sub != nil {
+			_ = a.sub.close()
+		}
+	}()
+
+	backoff := a.minReconnectBackoff()
+	for {
+		if sub != nil {
+			if !a.setSub(ctx, sub) {
+				_ = sub.close()
+				return
+			}
+
+			err := a.listen(ctx, sub)
+			_ = sub.close()
+			a.setHealthy(false)
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			a.reportError(fmt.Errorf("receive: %w", err))
+			backoff = a.minReconnectBackoff()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		var err error
+		if sub, err = a.subscribe(ctx); err != nil {
+			a.reportError(err)
+
+			if backoff *= 2; backoff > a.maxReconnectBackoff() {
+				backoff = a.maxReconnectBackoff()
+			}
+		}
+	}
+}
+
+// setSub stores current subscription, so that it can be closed
+// when ctx is done. It returns false if ctx is already done.
+func (a *RedisAdapter) setSub(ctx context.Context, sub redisSubscription) bool {
+	a.subMu.Lock()
+	defer a.subMu.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	a.sub = sub
+
+	return true
+}
+
+// listen handles messages until subscription fails.
+func (a *RedisAdapter) listen(ctx context.Context, sub redisSubscription) error {
+	for {
+		channel, payload, err := sub.receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		a.handleMessage(ctx, channel, payload)
+	}
+}
+
+func (a *RedisAdapter) handleMessage(ctx context.Context, channel, payload string) {
+	d, err := a.proto.decode(a.envelope(), channel, []byte(payload))
+	if errors.Is(err, errIgnoredMessage) {
+		return
+	}
+
+	if err != nil {
+		a.metrics.Malformed.Inc()
+		a.reportError(fmt.Errorf("decode message: %w", err))
+
+		return
+	}
+
+	// Messages from this node were already handled when sent.
+	if d.UID == a.uid {
+		return
+	}
+
+	a.metrics.Received.Inc()
+
+	switch d.Type {
+	case PushTypeBroadcast:
+		_ = a.MemoryAdapter.Broadcast(ctx, d.Packet, d.Opts)
+	case PushTypeServerSideEmit:
+		// Handler can make requests to other nodes itself,
+		// so it must not block receiving of responses.
+		// Events of each node are handled in order they were sent.
+		a.handleInOrder(d.UID, func() {
+			ack := a.recvr.ReceivedServerSide(ctx, d.Event, d.Args)
+			if d.RequestID == "" {
+				return
+			}
+
+			go func() {
+				if err := a.send(ctx, PushData{
+					Type:      PushTypeServerSideEmitResponse,
+					RequestID: d.RequestID,
+					Data:      ack,
+				}); err != nil {
+					a.reportError(fmt.Errorf("respond to serverSideEmit: %w", err))
+				}
+			}()
+		})
+	case PushTypeSocketsJoin, PushTypeSocketsLeave, PushTypeDisconnectSockets:
+		a.apply(ctx, d)
+	case PushTypeFetchSockets:
+		sockets, _ := a.MemoryAdapter.FetchSockets(ctx, d.Opts)
+
+		if err := a.send(ctx, PushData{
+			Type:      PushTypeFetchSocketsResponse,
+			RequestID: d.RequestID,
+			Sockets:   sockets,
+		}); err != nil {
+			a.reportError(fmt.Errorf("respond to fetchSockets: %w", err))
+		}
+	case PushTypeInitialHeartbeat, PushTypeHeartbeat, PushTypeNodeClose:
+		a.handleHeartbeat(ctx, d)
+	case PushTypeUserRooms, PushTypeUserRoomsAdded:
+		a.handleUserRooms(d)
+	case PushTypeFetchSocketsResponse, PushTypeServerSideEmitResponse:
+		a.requestsMu.Lock()
+		responses, ok := a.requests[d.RequestID]
+		a.requestsMu.Unlock()
+
+		if ok {
+			select {
+			case responses <- d:
+			default:
+				// Buffer is full only if more nodes
+				// responded than expected.
+			}
+		}
+	}
+}
+
+// handleInOrder runs fn after functions previously passed for the same
+// node returned. Each node with pending functions has its own goroutine,
+// which exits when there are none, so receiving is never blocked.
+func (a *RedisAdapter) handleInOrder(uid string, fn func()) {
+	a.handlersMu.Lock()
+	queue, running := a.handlers[uid]
+	a.handlers[uid] = append(queue, fn)
+	a.handlersMu.Unlock()
+
+	if running {
+		return
+	}
+
+	go func() {
+		for {
+			a.handlersMu.Lock()
+			queue := a.handlers[uid]
+			if len(queue) == 0 {
+				delete(a.handlers, uid)
+				a.handlersMu.Unlock()
+
+				return
+			}
+
+			fn := queue[0]
+			queue[0] = nil
+			a.handlers[uid] = queue[1:]
+			a.handlersMu.Unlock()
+
+			fn()
+		}
+	}()
+}
+
+func (a *RedisAdapter) setHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+
+	atomic.StoreInt32(&a.healthy, v)
+	a.metrics.Healthy.Set(float64(v))
+}
+
+func (a *RedisAdapter) reportError(err error) {
+	if a.OnError != nil {
+		a.OnError(err)
+	}
+}
+
+func (a *RedisAdapter) minReconnectBackoff() time.Duration {
+	if a.MinReconnectBackoff <= 0 {
+		return DefaultMinReconnectBackoff
+	}
+
+	return a.MinReconnectBackoff
+}
+
+func (a *RedisAdapter) envelope() envelope {
+	return envelope{codec: a.Codec, compressThreshold: a.CompressThreshold}
+}
+
+func (a *RedisAdapter) requestTimeout() time.Duration {
+	if a.RequestTimeout <= 0 {
+		return DefaultRequestTimeout
+	}
+
+	return a.RequestTimeout
+}
+
+func (a *RedisAdapter) maxReconnectBackoff() time.Duration {
+	if a.MaxReconnectBackoff <= 0 {
+		return DefaultMaxReconnectBackoff
+	}
+
+	return a.MaxReconnectBackoff
+}
@@ -0,0 +1,525 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// DefaultNodeRedisKey is channel prefix used by `NewNodeRedisAdapter`
+// if no key is provided. It is the same as in @socket.io/redis-adapter.
+const DefaultNodeRedisKey = "socket.io"
+
+// NodeRequestType is type of request sent on request channel
+// by @socket.io/redis-adapter.
+type NodeRequestType int
+
+const (
+	NodeRequestSockets NodeRequestType = iota
+	NodeRequestAllRooms
+	NodeRequestRemoteJoin
+	NodeRequestRemoteLeave
+	NodeRequestRemoteDisconnect
+	NodeRequestRemoteFetch
+	NodeRequestServerSideEmit
+	NodeRequestBroadcast
+	NodeRequestBroadcastClientCount
+	NodeRequestBroadcastAck
+)
+
+// Heartbeats are not part of @socket.io/redis-adapter protocol.
+// Node.js servers ignore requests of unknown types.
+const (
+	nodeRequestInitialHeartbeat NodeRequestType = iota + 100
+	nodeRequestHeartbeat
+	nodeRequestNodeClose
+)
+
+// NewNodeRedisAdapter creates RedisAdapter that is wire-compatible with
+// Node.js @socket.io/redis-adapter, so Go and Node.js servers
+// can share rooms and broadcasts.
+//
+// Broadcasts are published as MessagePack encoded `[uid, packet, opts]`
+// to "<key>#/#" channel, or to "<key>#/#<room>#" if exactly one room is selected.
+// Requests are published as JSON to "<key>-request#/#" channel.
+// Requests encoded with MessagePack are accepted as well.
+//
+// Requests for joining and leaving rooms, disconnecting and fetching sockets
+// and server-side events without acknowledgement are handled,
+// other requests are ignored.
+func NewNodeRedisAdapter(reg prometheus.Registerer, r redis.UniversalClient, key string) *RedisAdapter {
+	if key == "" {
+		key = DefaultNodeRedisKey
+	}
+
+	return newRedisAdapter(reg, r, "redis", newNodeRedisProtocol(key, DefaultNamespace))
+}
+
+// nodeRedisProtocol implements protocol of @socket.io/redis-adapter
+// for a single namespace.
+type nodeRedisProtocol struct {
+	nsp              string
+	broadcastChannel string
+	reqChannel       string
+	respChannel      string
+}
+
+func newNodeRedisProtocol(key, nsp string) nodeRedisProtocol {
+	return nodeRedisProtocol{
+		nsp:              nsp,
+		broadcastChannel: key + "#" + nsp + "#",
+		reqChannel:       key + "-request#" + nsp + "#",
+		respChannel:      key + "-response#" + nsp + "#",
+	}
+}
+
+// nodePacket is socket.io-parser packet.
+type nodePacket struct {
+	Type int    `msgpack:"type"`
+	Data []any  `msgpack:"data"`
+	Nsp  string `msgpack:"nsp"`
+	ID   *int   `msgpack:"id,omitempty"`
+}
+
+type nodeBroadcastFlags struct {
+	Local bool `msgpack:"local,omitempty" json:"local,omitempty"`
+}
+
+type nodeBroadcastOptions struct {
+	Rooms  []string           `msgpack:"rooms" json:"rooms"`
+	Except []string           `msgpack:"except" json:"except"`
+	Flags  nodeBroadcastFlags `msgpack:"flags" json:"flags"`
+}
+
+// nodeRequest is request sent on request channel.
+// Only fields used by this adapter are defined.
+type nodeRequest struct {
+	UID       string                `json:"uid,omitempty"`
+	RequestID string                `json:"requestId,omitempty"`
+	Type      NodeRequestType       `json:"type"`
+	Opts      *nodeBroadcastOptions `json:"opts,omitempty"`
+	Rooms     []string              `json:"rooms,omitempty"`
+	Close     bool                  `json:"close,omitempty"`
+	Data      []json.RawMessage     `json:"data,omitempty"`
+}
+
+// nodeResponse is response sent on response channel.
+type nodeResponse struct {
+	Type      NodeRequestType `json:"type,omitempty"`
+	RequestID string          `json:"requestId"`
+	Sockets   []nodeSocket    `json:"sockets,omitempty"`
+	// Data is acknowledgement of server-side event.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// nodeSocket is socket in response to fetch sockets request.
+type nodeSocket struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"userId,omitempty"`
+	Handshake nodeHandshake   `json:"handshake"`
+	Rooms     []string        `json:"rooms"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// nodeHandshake is handshake details of Node.js socket.
+// Fields that are not known for Go sockets are sent empty.
+type nodeHandshake struct {
+	Time    string          `json:"time"`
+	Issued  int64           `json:"issued"`
+	Address string          `json:"address"`
+	Auth    json.RawMessage `json:"auth,omitempty"`
+	Headers map[string]any  `json:"headers"`
+	Query   map[string]any  `json:"query"`
+}
+
+func (p nodeRedisProtocol) channels() ([]string, []string) {
+	return []string{p.reqChannel, p.respChannel}, []string{p.broadcastChannel + "*"}
+}
+
+func (p nodeRedisProtocol) requestChannel() string {
+	return p.reqChannel
+}
+
+// nodeChannel returns empty string, as Node.js adapter
+// does not route messages to single nodes.
+func (p nodeRedisProtocol) nodeChannel(string) string {
+	return ""
+}
+
+// foreignNodes returns true, as Node.js servers do not send heartbeats,
+// so only Go nodes are known from them.
+func (p nodeRedisProtocol) foreignNodes() bool {
+	return true
+}
+
+func (p nodeRedisProtocol) encode(_ envelope, d PushData) (string, []byte, error) {
+	switch d.Type {
+	case PushTypeBroadcast:
+		return p.encodeBroadcast(d)
+	case PushTypeServerSideEmit:
+		event, _ := json.Marshal(d.Event)
+
+		data := append([]json.RawMessage{event}, d.Args...)
+
+		return p.encodeRequest(nodeRequest{UID: d.UID, RequestID: d.RequestID, Type: NodeRequestServerSideEmit, Data: data})
+	case PushTypeInitialHeartbeat, PushTypeHeartbeat, PushTypeNodeClose:
+		reqType := map[PushType]NodeRequestType{
+			PushTypeInitialHeartbeat: nodeRequestInitialHeartbeat,
+			PushTypeHeartbeat:        nodeRequestHeartbeat,
+			PushTypeNodeClose:        nodeRequestNodeClose,
+		}[d.Type]
+
+		return p.encodeRequest(nodeRequest{UID: d.UID, Type: reqType})
+	case PushTypeServerSideEmitResponse:
+		payload, err := json.Marshal(nodeResponse{
+			Type:      NodeRequestServerSideEmit,
+			RequestID: d.RequestID,
+			Data:      d.Data,
+		})
+
+		return p.respChannel, payload, err
+	case PushTypeSocketsJoin, PushTypeSocketsLeave:
+		reqType := NodeRequestRemoteJoin
+		if d.Type == PushTypeSocketsLeave {
+			reqType = NodeRequestRemoteLeave
+		}
+
+		opts := toNodeBroadcastOptions(d.Opts)
+
+		return p.encodeRequest(nodeRequest{UID: d.UID, Type: reqType, Opts: &opts, Rooms: d.Rooms})
+	case PushTypeDisconnectSockets:
+		opts := toNodeBroadcastOptions(d.Opts)
+
+		return p.encodeRequest(nodeRequest{UID: d.UID, Type: NodeRequestRemoteDisconnect, Opts: &opts, Close: true})
+	case PushTypeFetchSockets:
+		opts := toNodeBroadcastOptions(d.Opts)
+
+		return p.encodeRequest(nodeRequest{UID: d.UID, RequestID: d.RequestID, Type: NodeRequestRemoteFetch, Opts: &opts})
+	case PushTypeFetchSocketsResponse:
+		resp := nodeResponse{Type: NodeRequestRemoteFetch, RequestID: d.RequestID, Sockets: make([]nodeSocket, len(d.Sockets))}
+		for i, info := range d.Sockets {
+			resp.Sockets[i] = toNodeSocket(info)
+		}
+
+		payload, err := json.Marshal(resp)
+
+		return p.respChannel, payload, err
+	default:
+		return "", nil, fmt.Errorf("unsupported message type %d", d.Type)
+	}
+}
+
+func (p nodeRedisProtocol) encodeBroadcast(d PushData) (string, []byte, error) {
+	data, err := jsonToValue(d.Packet.Data)
+	if err != nil {
+		return "", nil, fmt.Errorf("convert packet data: %w", err)
+	}
+
+	args, ok := data.([]any)
+	if !ok {
+		return "", nil, fmt.Errorf("packet data must be an array, got %T", data)
+	}
+
+	packetType, err := strconv.Atoi(string(d.Packet.Type))
+	if err != nil {
+		return "", nil, fmt.Errorf("packet type %q: %w", d.Packet.Type, err)
+	}
+
+	// Integers are encoded in the smallest format,
+	// the same way Node.js encoder does it.
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+
+	if err := enc.Encode([]any{
+		d.UID,
+		nodePacket{Type: packetType, Data: args, Nsp: p.nsp, ID: d.Packet.AckID},
+		toNodeBroadcastOptions(d.Opts),
+	}); err != nil {
+		return "", nil, err
+	}
+
+	channel := p.broadcastChannel
+	if len(d.Opts.Rooms) == 1 {
+		channel += d.Opts.Rooms[0] + "#"
+	}
+
+	return channel, buf.Bytes(), nil
+}
+
+func (p nodeRedisProtocol) encodeRequest(req nodeRequest) (string, []byte, error) {
+	payload, err := json.Marshal(req)
+
+	return p.reqChannel, payload, err
+}
+
+func (p nodeRedisProtocol) decode(_ envelope, channel string, payload []byte) (PushData, error) {
+	switch {
+	case channel == p.reqChannel:
+		return p.decodeRequest(payload)
+	case channel == p.respChannel:
+		return p.decodeResponse(payload)
+	case strings.HasPrefix(channel, p.broadcastChannel):
+		return p.decodeBroadcast(payload)
+	default:
+		return PushData{}, errIgnoredMessage
+	}
+}
+
+func (p nodeRedisProtocol) decodeBroadcast(payload []byte) (PushData, error) {
+	var parts []msgpack.RawMessage
+	if err := msgpack.Unmarshal(payload, &parts); err != nil {
+		return PushData{}, err
+	}
+
+	if len(parts) != 3 {
+		return PushData{}, fmt.Errorf("broadcast must have 3 parts, got %d", len(parts))
+	}
+
+	var (
+		d      = PushData{Type: PushTypeBroadcast}
+		packet nodePacket
+		opts   nodeBroadcastOptions
+	)
+
+	if err := msgpack.Unmarshal(parts[0], &d.UID); err != nil {
+		return PushData{}, fmt.Errorf("uid: %w", err)
+	}
+
+	if err := msgpack.Unmarshal(parts[1], &packet); err != nil {
+		return PushData{}, fmt.Errorf("packet: %w", err)
+	}
+
+	if err := msgpack.Unmarshal(parts[2], &opts); err != nil {
+		return PushData{}, fmt.Errorf("opts: %w", err)
+	}
+
+	if packet.Nsp == "" {
+		packet.Nsp = DefaultNamespace
+	}
+
+	if packet.Nsp != p.nsp {
+		return PushData{}, errIgnoredMessage
+	}
+
+	data, err := json.Marshal(packet.Data)
+	if err != nil {
+		return PushData{}, fmt.Errorf("packet data: %w", err)
+	}
+
+	d.Packet = Packet{
+		Type:      PacketType(strconv.Itoa(packet.Type)),
+		Namespace: packet.Nsp,
+		AckID:     packet.ID,
+		Data:      data,
+	}
+	d.Opts = opts.toBroadcastOptions()
+
+	return d, nil
+}
+
+func (p nodeRedisProtocol) decodeRequest(payload []byte) (PushData, error) {
+	// Requests are JSON encoded, but may be MessagePack
+	// encoded as well, depending on adapter's parser.
+	if !bytes.HasPrefix(payload, []byte("{")) {
+		var req map[string]any
+		if err := msgpack.Unmarshal(payload, &req); err != nil {
+			return PushData{}, err
+		}
+
+		var err error
+		if payload, err = json.Marshal(req); err != nil {
+			return PushData{}, err
+		}
+	}
+
+	var req nodeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return PushData{}, err
+	}
+
+	d := PushData{UID: req.UID}
+
+	switch req.Type {
+	case NodeRequestRemoteJoin, NodeRequestRemoteLeave:
+		// Requests without options target single socket
+		// and expect response, which is not supported.
+		if req.Opts == nil {
+			return PushData{}, errIgnoredMessage
+		}
+
+		d.Type = PushTypeSocketsJoin
+		if req.Type == NodeRequestRemoteLeave {
+			d.Type = PushTypeSocketsLeave
+		}
+
+		d.Opts = req.Opts.toBroadcastOptions()
+		d.Rooms = req.Rooms
+	case NodeRequestRemoteDisconnect:
+		if req.Opts == nil {
+			return PushData{}, errIgnoredMessage
+		}
+
+		// Only default namespace is supported, so socket
+		// is always closed, regardless of `close` option.
+		d.Type = PushTypeDisconnectSockets
+		d.Opts = req.Opts.toBroadcastOptions()
+	case NodeRequestRemoteFetch:
+		if req.Opts == nil {
+			return PushData{}, errIgnoredMessage
+		}
+
+		d.Type = PushTypeFetchSockets
+		d.RequestID = req.RequestID
+		d.Opts = req.Opts.toBroadcastOptions()
+	case NodeRequestServerSideEmit:
+		if len(req.Data) == 0 {
+			return PushData{}, fmt.Errorf("server-side event without name")
+		}
+
+		d.Type = PushTypeServerSideEmit
+		d.RequestID = req.RequestID
+		if err := json.Unmarshal(req.Data[0], &d.Event); err != nil {
+			return PushData{}, fmt.Errorf("server-side event name: %w", err)
+		}
+
+		d.Args = req.Data[1:]
+	case nodeRequestInitialHeartbeat:
+		d.Type = PushTypeInitialHeartbeat
+	case nodeRequestHeartbeat:
+		d.Type = PushTypeHeartbeat
+	case nodeRequestNodeClose:
+		d.Type = PushTypeNodeClose
+	default:
+		return PushData{}, errIgnoredMessage
+	}
+
+	return d, nil
+}
+
+// decodeResponse decodes responses to fetch sockets
+// and server-side emit requests. Other responses are ignored.
+func (p nodeRedisProtocol) decodeResponse(payload []byte) (PushData, error) {
+	var resp nodeResponse
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return PushData{}, err
+	}
+
+	if resp.Type == NodeRequestServerSideEmit {
+		data := resp.Data
+		if data == nil {
+			data = json.RawMessage("null")
+		}
+
+		return PushData{
+			Type:      PushTypeServerSideEmitResponse,
+			RequestID: resp.RequestID,
+			Data:      data,
+		}, nil
+	}
+
+	if resp.Sockets == nil {
+		return PushData{}, errIgnoredMessage
+	}
+
+	d := PushData{
+		Type:      PushTypeFetchSocketsResponse,
+		RequestID: resp.RequestID,
+		Sockets:   make([]SocketInfo, len(resp.Sockets)),
+	}
+
+	for i, s := range resp.Sockets {
+		d.Sockets[i] = SocketInfo{
+			ID:     s.ID,
+			UserID: s.UserID,
+			Rooms:  s.Rooms,
+			Handshake: Handshake{
+				Time:    time.UnixMilli(s.Handshake.Issued),
+				Issued:  s.Handshake.Issued,
+				Address: s.Handshake.Address,
+				Auth:    s.Handshake.Auth,
+			},
+			Data: s.Data,
+		}
+	}
+
+	return d, nil
+}
+
+func toNodeSocket(info SocketInfo) nodeSocket {
+	return nodeSocket{
+		ID:     info.ID,
+		UserID: info.UserID,
+		Handshake: nodeHandshake{
+			Time:    info.Handshake.Time.UTC().Format(time.RFC1123),
+			Issued:  info.Handshake.Issued,
+			Address: info.Handshake.Address,
+			Auth:    info.Handshake.Auth,
+			Headers: map[string]any{},
+			Query:   map[string]any{},
+		},
+		Rooms: append(make([]string, 0, len(info.Rooms)), info.Rooms...),
+		Data:  info.Data,
+	}
+}
+
+func toNodeBroadcastOptions(opts BroadcastOptions) nodeBroadcastOptions {
+	// Node.js adapter expects arrays, even if they are empty.
+	return nodeBroadcastOptions{
+		Rooms:  append(make([]string, 0, len(opts.Rooms)), opts.Rooms...),
+		Except: append(make([]string, 0, len(opts.Except)), opts.Except...),
+		Flags:  nodeBroadcastFlags{Local: opts.Flags.Local},
+	}
+}
+
+func (o nodeBroadcastOptions) toBroadcastOptions() BroadcastOptions {
+	return BroadcastOptions{
+		Rooms:  o.Rooms,
+		Except: o.Except,
+		Flags:  BroadcastFlags{Local: o.Flags.Local},
+	}
+}
+
+// jsonToValue decodes JSON into value that can be encoded with MessagePack.
+// Integer numbers are decoded as int64, other numbers as float64.
+func jsonToValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(v), nil
+}
+
+func convertNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+
+		return f
+	case []any:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	}
+
+	return v
+}
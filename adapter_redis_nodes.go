@@ -0,0 +1,159 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultHeartbeatInterval is used if `RedisAdapter.HeartbeatInterval` is not set.
+const DefaultHeartbeatInterval = 5 * time.Second
+
+// Nodes returns nodes that sent heartbeat within `HeartbeatTimeout`,
+// including this one. Other nodes are sorted by uid.
+//
+// Nodes are known only while adapter is started.
+func (a *RedisAdapter) Nodes() []NodeInfo {
+	now := time.Now()
+	deadline := now.Add(-a.heartbeatTimeout())
+
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	nodes := make([]NodeInfo, 0, len(a.nodes)+1)
+	for uid, lastSeen := range a.nodes {
+		if lastSeen.After(deadline) {
+			nodes = append(nodes, NodeInfo{UID: uid, LastSeen: lastSeen})
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].UID < nodes[j].UID
+	})
+
+	return append([]NodeInfo{{UID: a.uid, LastSeen: now, Self: true}}, nodes...)
+}
+
+// heartbeat announces this node to other nodes, sends heartbeats
+// and expires nodes that stopped sending them, until ctx is done.
+// After that other nodes are notified that this node is closed.
+func (a *RedisAdapter) heartbeat(ctx context.Context) {
+	a.resetNodes()
+
+	// Other nodes respond to initial heartbeat, so
+	// they are known without waiting for the interval.
+	a.sendHeartbeat(ctx, PushTypeInitialHeartbeat)
+
+	ticker := time.NewTicker(a.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.resetNodes()
+
+			ctx, cancel := context.WithTimeout(context.Background(), a.requestTimeout())
+			defer cancel()
+
+			a.sendHeartbeat(ctx, PushTypeNodeClose)
+
+			return
+		case now := <-ticker.C:
+			a.sendHeartbeat(ctx, PushTypeHeartbeat)
+			a.expireNodes(now)
+		case <-a.roomsAdded:
+			a.sendAddedRooms(ctx)
+		}
+	}
+}
+
+func (a *RedisAdapter) sendHeartbeat(ctx context.Context, typ PushType) {
+	if err := a.send(ctx, PushData{Type: typ}); err != nil && ctx.Err() == nil {
+		a.reportError(fmt.Errorf("heartbeat: %w", err))
+	}
+
+	if typ != PushTypeNodeClose {
+		a.sendUserRooms(ctx)
+	}
+}
+
+// handleHeartbeat updates registry with message from other node.
+func (a *RedisAdapter) handleHeartbeat(ctx context.Context, d PushData) {
+	switch d.Type {
+	case PushTypeInitialHeartbeat:
+		a.seeNode(d.UID)
+		a.sendHeartbeat(ctx, PushTypeHeartbeat)
+	case PushTypeHeartbeat:
+		a.seeNode(d.UID)
+	case PushTypeNodeClose:
+		a.nodesMu.Lock()
+		delete(a.nodes, d.UID)
+		a.forgetRoomsUnsafe(d.UID)
+		a.updateNodesMetric()
+		a.nodesMu.Unlock()
+	}
+}
+
+func (a *RedisAdapter) seeNode(uid string) {
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	a.nodes[uid] = time.Now()
+	a.updateNodesMetric()
+}
+
+// expireNodes removes nodes that did not send
+// heartbeat within `HeartbeatTimeout`.
+func (a *RedisAdapter) expireNodes(now time.Time) {
+	deadline := now.Add(-a.heartbeatTimeout())
+
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	for uid, lastSeen := range a.nodes {
+		if !lastSeen.After(deadline) {
+			delete(a.nodes, uid)
+			a.forgetRoomsUnsafe(uid)
+		}
+	}
+
+	a.updateNodesMetric()
+}
+
+func (a *RedisAdapter) resetNodes() {
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	a.nodes = make(map[string]time.Time)
+	a.nodeRooms = make(map[string]map[string]struct{})
+	a.roomNodes = make(map[string]map[string]struct{})
+	a.updateNodesMetric()
+}
+
+// liveNodes returns number of other nodes that are known to be alive.
+func (a *RedisAdapter) liveNodes() int {
+	// Registry is pruned only periodically.
+	return len(a.Nodes()) - 1
+}
+
+// updateNodesMetric must be called with nodesMu held.
+func (a *RedisAdapter) updateNodesMetric() {
+	a.metrics.Nodes.Set(float64(len(a.nodes) + 1))
+}
+
+func (a *RedisAdapter) heartbeatInterval() time.Duration {
+	if a.HeartbeatInterval <= 0 {
+		return DefaultHeartbeatInterval
+	}
+
+	return a.HeartbeatInterval
+}
+
+func (a *RedisAdapter) heartbeatTimeout() time.Duration {
+	if a.HeartbeatTimeout <= 0 {
+		return 3 * a.heartbeatInterval()
+	}
+
+	return a.HeartbeatTimeout
+}
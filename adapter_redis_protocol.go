@@ -0,0 +1,70 @@
+package socketio
+
+import "errors"
+
+// errIgnoredMessage is returned by redisProtocol when message
+// is valid, but is not handled by this adapter.
+var errIgnoredMessage = errors.New("ignored message")
+
+// redisProtocol defines channels and message format used by RedisAdapter.
+type redisProtocol interface {
+	// channels returns channels and patterns that adapter subscribes to.
+	channels() (channels, patterns []string)
+	// encode returns channel to publish message to and message payload.
+	// Protocols that publish `PushData` encode it with env.
+	encode(env envelope, d PushData) (channel string, payload []byte, err error)
+	// decode decodes message received from channel.
+	decode(env envelope, channel string, payload []byte) (PushData, error)
+	// requestChannel returns channel that all nodes receive requests from.
+	requestChannel() string
+	// nodeChannel returns channel that only node with uid receives
+	// messages from, or empty string if protocol does not support it.
+	nodeChannel(uid string) string
+	// foreignNodes reports whether nodes that do not send heartbeats,
+	// such as Node.js servers, can respond to requests.
+	foreignNodes() bool
+}
+
+// envelopeRedisProtocol publishes `PushData` encoded
+// with adapter's envelope codec to single channel.
+type envelopeRedisProtocol struct {
+	channel string
+}
+
+func (p envelopeRedisProtocol) channels() ([]string, []string) {
+	return []string{p.channel}, nil
+}
+
+func (p envelopeRedisProtocol) requestChannel() string {
+	return p.channel
+}
+
+func (p envelopeRedisProtocol) nodeChannel(uid string) string {
+	return p.channel + ":node:" + uid
+}
+
+func (p envelopeRedisProtocol) foreignNodes() bool {
+	return false
+}
+
+func (p envelopeRedisProtocol) encode(env envelope, d PushData) (string, []byte, error) {
+	bts, err := env.marshal(d)
+
+	return p.channel, bts, err
+}
+
+func (p envelopeRedisProtocol) decode(env envelope, _ string, payload []byte) (PushData, error) {
+	d, err := env.unmarshal(payload)
+	if err != nil {
+		return d, err
+	}
+
+	// Engine serves only default namespace, so packets for other
+	// namespaces, like those sent by `Emitter.Of`, have no sockets.
+	// Empty namespace is encoded the same way as default one.
+	if d.Type == PushTypeBroadcast && d.Packet.Namespace != "" && d.Packet.Namespace != DefaultNamespace {
+		return PushData{}, errIgnoredMessage
+	}
+
+	return d, nil
+}
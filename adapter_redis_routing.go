@@ -0,0 +1,191 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// onRoomCreated schedules announcement of user room
+// that got its first local socket. It is called with
+// MemoryAdapter's lock held, so it must not block.
+func (a *RedisAdapter) onRoomCreated(room string) {
+	if !a.RouteUsers || !isUserRoom(room) {
+		return
+	}
+
+	a.addedMu.Lock()
+	a.addedRooms[room] = struct{}{}
+	a.addedMu.Unlock()
+
+	select {
+	case a.roomsAdded <- struct{}{}:
+	default:
+	}
+}
+
+// AddSocket adds local socket to rooms. User rooms that got their
+// first local socket are announced to other nodes before it returns,
+// so events routed to the user after socket connected reach this node.
+func (a *RedisAdapter) AddSocket(socketID string, rooms ...string) {
+	a.MemoryAdapter.AddSocket(socketID, rooms...)
+
+	if !a.RouteUsers {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.requestTimeout())
+	defer cancel()
+
+	a.sendAddedRooms(ctx)
+}
+
+// sendUserRooms sends all local user rooms to other nodes,
+// which replace rooms previously known for this node.
+func (a *RedisAdapter) sendUserRooms(ctx context.Context) {
+	if !a.RouteUsers {
+		return
+	}
+
+	// Rooms added after the snapshot are announced after it.
+	a.announceMu.Lock()
+	defer a.announceMu.Unlock()
+
+	var rooms []string
+	for _, room := range a.MemoryAdapter.Rooms() {
+		if isUserRoom(room) {
+			rooms = append(rooms, room)
+		}
+	}
+
+	if err := a.send(ctx, PushData{Type: PushTypeUserRooms, Rooms: rooms}); err != nil && ctx.Err() == nil {
+		a.reportError(fmt.Errorf("user rooms: %w", err))
+	}
+}
+
+// sendAddedRooms sends user rooms created since last announcement,
+// so that other nodes don't wait for heartbeat to route to them.
+//
+// Rooms that are being announced by other call
+// are announced when it returns.
+func (a *RedisAdapter) sendAddedRooms(ctx context.Context) {
+	a.announceMu.Lock()
+	defer a.announceMu.Unlock()
+
+	a.addedMu.Lock()
+	rooms := keys(a.addedRooms)
+	a.addedRooms = make(map[string]struct{})
+	a.addedMu.Unlock()
+
+	if len(rooms) == 0 {
+		return
+	}
+
+	if err := a.send(ctx, PushData{Type: PushTypeUserRoomsAdded, Rooms: rooms}); err != nil && ctx.Err() == nil {
+		a.reportError(fmt.Errorf("added user rooms: %w", err))
+	}
+}
+
+// handleUserRooms updates user rooms of other node.
+func (a *RedisAdapter) handleUserRooms(d PushData) {
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	// Rooms of nodes that closed or expired are not accepted,
+	// until node sends heartbeat again.
+	if _, ok := a.nodes[d.UID]; !ok {
+		return
+	}
+
+	if d.Type == PushTypeUserRooms {
+		a.forgetRoomsUnsafe(d.UID)
+	}
+
+	rooms := a.nodeRooms[d.UID]
+	if rooms == nil {
+		rooms = make(map[string]struct{}, len(d.Rooms))
+		a.nodeRooms[d.UID] = rooms
+	}
+
+	for _, room := range d.Rooms {
+		rooms[room] = struct{}{}
+
+		nodes := a.roomNodes[room]
+		if nodes == nil {
+			nodes = make(map[string]struct{})
+			a.roomNodes[room] = nodes
+		}
+
+		nodes[d.UID] = struct{}{}
+	}
+}
+
+// forgetRoomsUnsafe removes user rooms of the node.
+// It must be called with nodesMu held.
+func (a *RedisAdapter) forgetRoomsUnsafe(uid string) {
+	for room := range a.nodeRooms[uid] {
+		nodes := a.roomNodes[room]
+		delete(nodes, uid)
+
+		if len(nodes) == 0 {
+			delete(a.roomNodes, room)
+		}
+	}
+
+	delete(a.nodeRooms, uid)
+}
+
+// routeUsers returns channels of other nodes that have sockets in rooms
+// selected by opts. False is returned if packet must be published to all nodes:
+// when not only user rooms are selected, or some node has not reported its
+// user rooms yet, or some user is not known to be connected to any node.
+//
+// No channels are returned if users are connected only to this node.
+func (a *RedisAdapter) routeUsers(opts BroadcastOptions) ([]string, bool) {
+	if !a.RouteUsers || len(opts.Rooms) == 0 || a.proto.nodeChannel(a.uid) == "" {
+		return nil, false
+	}
+
+	for _, room := range opts.Rooms {
+		if !isUserRoom(room) {
+			return nil, false
+		}
+	}
+
+	local := a.MemoryAdapter.hasRooms(opts.Rooms)
+
+	a.nodesMu.Lock()
+	defer a.nodesMu.Unlock()
+
+	for uid := range a.nodes {
+		if _, ok := a.nodeRooms[uid]; !ok {
+			return nil, false
+		}
+	}
+
+	uids := make(map[string]struct{})
+	for _, room := range opts.Rooms {
+		nodes := a.roomNodes[room]
+		if len(nodes) == 0 && !local[room] {
+			return nil, false
+		}
+
+		for uid := range nodes {
+			uids[uid] = struct{}{}
+		}
+	}
+
+	channels := make([]string, 0, len(uids))
+	for uid := range uids {
+		channels = append(channels, a.proto.nodeChannel(uid))
+	}
+
+	sort.Strings(channels)
+
+	return channels, true
+}
+
+func isUserRoom(room string) bool {
+	return strings.HasPrefix(room, UserRoom(""))
+}
@@ -0,0 +1,131 @@
+package socketio_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestRedisAdapter_RouteUsers(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			srv := miniredis.RunT(t)
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				adapters[i] = startRoutingAdapter(t, srv, recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+func TestRedisAdapter_RouteUsersChannels(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	sub := newRedisClient(t, srv).PSubscribe(ctx, "events:websocket*")
+	t.Cleanup(func() { _ = sub.Close() })
+
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	msgs := sub.Channel()
+
+	senderRecvr := adaptertest.NewReceiver()
+	sender := startRoutingAdapter(t, srv, senderRecvr)
+
+	recvrs := []*adaptertest.Receiver{adaptertest.NewReceiver(), adaptertest.NewReceiver()}
+	nodes := make([]*socketio.RedisAdapter, len(recvrs))
+	for i, recvr := range recvrs {
+		recvr.Connect(socketio.SocketInfo{ID: "s1"})
+		nodes[i] = startRoutingAdapter(t, srv, recvr)
+	}
+
+	// broadcastChannels broadcasts packet and returns
+	// channels it was published to.
+	broadcastChannels := func(rooms ...string) []string {
+		require.NoError(t, sender.Broadcast(ctx, eventPacket("hello"), socketio.BroadcastOptions{Rooms: rooms}))
+		// Marker is published after broadcast, so all
+		// channels of the broadcast are received before it.
+		require.NoError(t, sender.Broadcast(ctx, eventPacket("marker"), socketio.BroadcastOptions{}))
+
+		var channels []string
+		for {
+			select {
+			case msg := <-msgs:
+				var d socketio.PushData
+				require.NoError(t, json.Unmarshal([]byte(msg.Payload), &d))
+
+				if d.UID != sender.UID() || d.Type != socketio.PushTypeBroadcast {
+					continue
+				}
+
+				if string(d.Packet.Data) == `["marker"]` {
+					return channels
+				}
+
+				channels = append(channels, msg.Channel)
+			case <-time.After(time.Second):
+				require.FailNow(t, "broadcast is not received")
+			}
+		}
+	}
+
+	nodeChannel := func(a *socketio.RedisAdapter) string {
+		return "events:websocket:node:" + a.UID()
+	}
+
+	// User that is not connected anywhere.
+	assert.Equal(t, []string{"events:websocket"}, broadcastChannels(socketio.UserRoom("alice")))
+
+	nodes[0].AddSocket("s1", "s1", socketio.UserRoom("alice"))
+	require.Eventually(t, func() bool {
+		channels := broadcastChannels(socketio.UserRoom("alice"))
+		return assert.ObjectsAreEqual([]string{nodeChannel(nodes[0])}, channels)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NotEmpty(t, recvrs[0].Packets("s1"))
+	assert.Empty(t, recvrs[1].Packets("s1"))
+
+	// Rooms that are not user rooms are published to all nodes.
+	assert.Equal(t, []string{"events:websocket"}, broadcastChannels(socketio.UserRoom("alice"), "room"))
+
+	// Room is announced before socket is added, so it is
+	// known to sender that received later message of the node.
+	nodes[1].AddSocket("s1", "s1", socketio.UserRoom("alice"))
+	require.NoError(t, nodes[1].ServerSideEmit(ctx, "added", nil))
+	require.Eventually(t, func() bool {
+		return len(senderRecvr.ServerSideEvents()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	assert.ElementsMatch(t, []string{nodeChannel(nodes[0]), nodeChannel(nodes[1])}, broadcastChannels(socketio.UserRoom("alice")))
+
+	// Closed node is not routed to.
+	require.NoError(t, nodes[1].Close())
+	require.Eventually(t, func() bool {
+		channels := broadcastChannels(socketio.UserRoom("alice"))
+		return assert.ObjectsAreEqual([]string{nodeChannel(nodes[0])}, channels)
+	}, time.Second, 10*time.Millisecond)
+}
+
+// startRoutingAdapter starts adapter that routes packets for users.
+func startRoutingAdapter(t *testing.T, srv *miniredis.Miniredis, recvr socketio.AdapterReceiver) *socketio.RedisAdapter {
+	t.Helper()
+
+	a := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+	a.RouteUsers = true
+	a.HeartbeatInterval = 50 * time.Millisecond
+	a.RequestTimeout = time.Second
+
+	return startAdapter(t, a, recvr)
+}
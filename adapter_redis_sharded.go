@@ -0,0 +1,674 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ Adapter = &ShardedRedisAdapter{}
+
+// ShardMode defines which rooms get separate channel in ShardedRedisAdapter.
+type ShardMode int
+
+const (
+	// ShardByRoom uses separate channel for every room,
+	// including rooms of single sockets.
+	ShardByRoom ShardMode = iota
+	// ShardByUser uses separate channel for rooms of users only.
+	// Messages for other rooms are published to the main channel.
+	ShardByUser
+)
+
+// ShardedRedisAdapter is RedisAdapter that publishes messages
+// with Redis sharded Pub/Sub (SPUBLISH/SSUBSCRIBE), which is
+// not broadcast to every shard of Redis Cluster.
+//
+// Messages for rooms are published to channels of these rooms,
+// and node subscribes to channels of rooms that have local sockets.
+// Other messages are published to the main channel, that all nodes
+// are subscribed to.
+type ShardedRedisAdapter struct {
+	*RedisAdapter
+
+	// ClassicPubSub uses PUBLISH/SUBSCRIBE instead of sharded commands
+	// for Redis versions that don't support them.
+	// Channels are partitioned the same way. Must be set before `Start`.
+	ClassicPubSub bool
+
+	proto shardedRedisProtocol
+
+	// applyMu orders application of room changes.
+	applyMu sync.Mutex
+	// roomsMu guards fields below. Rooms are changed with
+	// MemoryAdapter's lock held, so channels are not subscribed
+	// there, but changes are queued for `followRooms` instead.
+	roomsMu sync.Mutex
+	// roomsSub is current subscription, that follows local rooms.
+	roomsSub *shardedSubscription
+	// roomChanges are channels to subscribe (true) or
+	// unsubscribe (false) since changes were last applied.
+	roomChanges  map[string]bool
+	roomsChanged chan struct{}
+}
+
+// NewShardedRedisAdapter creates adapter that uses channel with provided
+// prefix as main channel, and "<prefix>#<room>" channels for rooms selected by mode.
+func NewShardedRedisAdapter(reg prometheus.Registerer, r redis.UniversalClient, prefix string, mode ShardMode) *ShardedRedisAdapter {
+	if prefix == "" {
+		prefix = "events:websocket"
+	}
+
+	proto := shardedRedisProtocol{
+		envelopeRedisProtocol: envelopeRedisProtocol{channel: prefix},
+		mode:                  mode,
+	}
+
+	a := &ShardedRedisAdapter{
+		RedisAdapter: newRedisAdapter(reg, r, "redis_sharded", proto),
+		proto:        proto,
+		roomChanges:  make(map[string]bool),
+		roomsChanged: make(chan struct{}, 1),
+	}
+
+	a.transport = &shardedTransport{adapter: a, r: r}
+	a.MemoryAdapter.onRoomCreated = a.onRoomCreated
+	a.MemoryAdapter.onRoomDeleted = a.onRoomDeleted
+
+	return a
+}
+
+// onRoomCreated queues subscription to channel
+// of the room that got its first local socket.
+func (a *ShardedRedisAdapter) onRoomCreated(room string) {
+	a.RedisAdapter.onRoomCreated(room)
+
+	if channel, ok := a.proto.roomChannel(room); ok {
+		a.queueRoomChange(channel, true)
+	}
+}
+
+// onRoomDeleted queues unsubscription from channel
+// of the room that lost its last local socket.
+func (a *ShardedRedisAdapter) onRoomDeleted(room string) {
+	if channel, ok := a.proto.roomChannel(room); ok {
+		a.queueRoomChange(channel, false)
+	}
+}
+
+func (a *ShardedRedisAdapter) queueRoomChange(channel string, subscribe bool) {
+	a.roomsMu.Lock()
+	a.roomChanges[channel] = subscribe
+	a.roomsMu.Unlock()
+
+	a.signalRoomsChanged()
+}
+
+func (a *ShardedRedisAdapter) signalRoomsChanged() {
+	select {
+	case a.roomsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// setRoomsSub makes subscription follow local rooms and
+// queues subscription to channels of current rooms.
+func (a *ShardedRedisAdapter) setRoomsSub(sub *shardedSubscription) {
+	// Rooms are not changed while lock is held,
+	// so no room is missed.
+	a.MemoryAdapter.mu.RLock()
+	defer a.MemoryAdapter.mu.RUnlock()
+
+	a.roomsMu.Lock()
+	defer a.roomsMu.Unlock()
+
+	// Changes queued for previous subscription are
+	// already reflected in current rooms.
+	a.roomsSub = sub
+	a.roomChanges = make(map[string]bool)
+
+	for room := range a.rooms {
+		if channel, ok := a.proto.roomChannel(room); ok {
+			a.roomChanges[channel] = true
+		}
+	}
+
+	a.signalRoomsChanged()
+}
+
+// AddSocket adds local socket to rooms. Channels of rooms that
+// got their first local socket are subscribed to before it returns,
+// so packets published to these rooms after that are received.
+func (a *ShardedRedisAdapter) AddSocket(socketID string, rooms ...string) {
+	a.RedisAdapter.AddSocket(socketID, rooms...)
+
+	a.roomsMu.Lock()
+	sub := a.roomsSub
+	a.roomsMu.Unlock()
+
+	// Rooms are subscribed to when adapter starts.
+	if sub == nil {
+		return
+	}
+
+	a.applyRoomChanges(sub)
+}
+
+// followRooms applies queued room changes to
+// subscription until it is closed or replaced.
+func (a *ShardedRedisAdapter) followRooms(sub *shardedSubscription) {
+	for {
+		select {
+		case <-sub.ctx.Done():
+			return
+		case <-a.roomsChanged:
+		}
+
+		if !a.applyRoomChanges(sub) {
+			// Signal belongs to the subscription that replaced this one.
+			a.signalRoomsChanged()
+
+			return
+		}
+	}
+}
+
+// applyRoomChanges applies queued room changes to subscription.
+// It returns false if subscription was replaced.
+//
+// Changes that are being applied by other call
+// are applied when it returns.
+func (a *ShardedRedisAdapter) applyRoomChanges(sub *shardedSubscription) bool {
+	a.applyMu.Lock()
+	defer a.applyMu.Unlock()
+
+	a.roomsMu.Lock()
+	if a.roomsSub != sub {
+		a.roomsMu.Unlock()
+		return false
+	}
+
+	changes := a.roomChanges
+	a.roomChanges = make(map[string]bool)
+	a.roomsMu.Unlock()
+
+	var subscribe, unsubscribe []string
+	for channel, ok := range changes {
+		if ok {
+			subscribe = append(subscribe, channel)
+		} else {
+			unsubscribe = append(unsubscribe, channel)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(sub.ctx, a.requestTimeout())
+	defer cancel()
+
+	if len(subscribe) != 0 {
+		if err := sub.subscribe(ctx, subscribe...); err != nil && sub.ctx.Err() == nil {
+			a.reportError(fmt.Errorf("subscribe to rooms: %w", err))
+		}
+	}
+
+	if len(unsubscribe) != 0 {
+		if err := sub.unsubscribe(ctx, unsubscribe...); err != nil && sub.ctx.Err() == nil {
+			a.reportError(fmt.Errorf("unsubscribe from rooms: %w", err))
+		}
+	}
+
+	return true
+}
+
+// Broadcast delivers packet to local sockets and publishes it
+// to channels of selected rooms, or to the main channel.
+func (a *ShardedRedisAdapter) Broadcast(ctx context.Context, packet Packet, opts BroadcastOptions) error {
+	_ = a.MemoryAdapter.Broadcast(ctx, packet, opts)
+
+	if opts.Flags.Local {
+		return nil
+	}
+
+	for _, opts := range a.splitByRoom(opts) {
+		if err := a.send(ctx, PushData{
+			Type:   PushTypeBroadcast,
+			Packet: packet,
+			Opts:   opts,
+		}); err != nil {
+			return fmt.Errorf("broadcast: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// splitByRoom splits options with several rooms into options with
+// single room each, so that each can be published to channel of the room.
+// Rooms that were already selected are excluded from the next ones,
+// so sockets that are in several rooms receive packet once.
+func (a *ShardedRedisAdapter) splitByRoom(opts BroadcastOptions) []BroadcastOptions {
+	if len(opts.Rooms) < 2 {
+		return []BroadcastOptions{opts}
+	}
+
+	for _, room := range opts.Rooms {
+		if _, ok := a.proto.roomChannel(room); !ok {
+			return []BroadcastOptions{opts}
+		}
+	}
+
+	res := make([]BroadcastOptions, len(opts.Rooms))
+	for i, room := range opts.Rooms {
+		except := append(opts.Except[:len(opts.Except):len(opts.Except)], opts.Rooms[:i]...)
+
+		res[i] = BroadcastOptions{
+			Rooms:  []string{room},
+			Except: except,
+			Flags:  opts.Flags,
+		}
+	}
+
+	return res
+}
+
+// shardedRedisProtocol publishes encoded `PushData` to channel
+// of the room if exactly one room is selected, or to the main channel.
+// Requests and responses are always published to the main channel,
+// so that all nodes receive them.
+type shardedRedisProtocol struct {
+	envelopeRedisProtocol
+
+	mode ShardMode
+}
+
+func (p shardedRedisProtocol) encode(env envelope, d PushData) (string, []byte, error) {
+	channel, bts, err := p.envelopeRedisProtocol.encode(env, d)
+
+	if len(d.Opts.Rooms) == 1 && d.RequestID == "" {
+		if roomChannel, ok := p.roomChannel(d.Opts.Rooms[0]); ok {
+			channel = roomChannel
+		}
+	}
+
+	return channel, bts, err
+}
+
+// roomChannel returns channel of the room, if room has one.
+func (p shardedRedisProtocol) roomChannel(room string) (string, bool) {
+	if p.mode == ShardByUser && !isUserRoom(room) {
+		return "", false
+	}
+
+	return p.channel + "#" + room, true
+}
+
+// shardedTransport uses sharded Pub/Sub, or classic
+// Pub/Sub if `ShardedRedisAdapter.ClassicPubSub` is set.
+type shardedTransport struct {
+	adapter *ShardedRedisAdapter
+	r       redis.UniversalClient
+}
+
+func (t *shardedTransport) publish(ctx context.Context, channel string, payload []byte) error {
+	if t.adapter.ClassicPubSub {
+		return t.r.Publish(ctx, channel, payload).Err()
+	}
+
+	return t.r.SPublish(ctx, channel, payload).Err()
+}
+
+func (t *shardedTransport) numSub(ctx context.Context, channel string) (int, error) {
+	cmd := t.r.PubSubShardNumSub
+	if t.adapter.ClassicPubSub {
+		cmd = t.r.PubSubNumSub
+	}
+
+	res, err := cmd(ctx, channel).Result()
+
+	return int(res[channel]), err
+}
+
+func (t *shardedTransport) subscribe(ctx context.Context, channels, patterns []string) (redisSubscription, error) {
+	if len(patterns) != 0 {
+		return nil, errors.New("patterns are not supported by sharded Pub/Sub")
+	}
+
+	subCtx, cancel := context.WithCancel(context.Background())
+	sub := &shardedSubscription{
+		t:        t,
+		ctx:      subCtx,
+		cancel:   cancel,
+		msgs:     make(chan *redis.Message),
+		errs:     make(chan error, 1),
+		subs:     make(map[string]*redis.PubSub),
+		chans:    make(map[string]map[string]struct{}),
+		confirms: make(map[string]chan struct{}),
+	}
+
+	if err := sub.subscribe(ctx, channels...); err != nil {
+		_ = sub.close()
+		return nil, err
+	}
+
+	t.adapter.setRoomsSub(sub)
+	go t.adapter.followRooms(sub)
+
+	return sub, nil
+}
+
+// group groups channels by connection they must be subscribed with.
+// Sharded channels of Redis Cluster are grouped by master node that
+// serves their hash slot, so there is one connection per shard.
+func (t *shardedTransport) group(ctx context.Context, channels []string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+
+	cluster, ok := t.r.(*redis.ClusterClient)
+	if !ok || t.adapter.ClassicPubSub {
+		groups[""] = channels
+		return groups, nil
+	}
+
+	for _, channel := range channels {
+		node, err := cluster.MasterForKey(ctx, channel)
+		if err != nil {
+			return nil, fmt.Errorf("find node of channel: %w", err)
+		}
+
+		addr := node.Options().Addr
+		groups[addr] = append(groups[addr], channel)
+	}
+
+	return groups, nil
+}
+
+// slots splits channels of single group into batches that can
+// be subscribed with single command. Sharded commands of Redis
+// Cluster accept only channels of the same hash slot.
+func (t *shardedTransport) slots(channels []string) [][]string {
+	if _, ok := t.r.(*redis.ClusterClient); !ok || t.adapter.ClassicPubSub {
+		return [][]string{channels}
+	}
+
+	slots := make(map[int][]string)
+	for _, channel := range channels {
+		slot := hashSlot(channel)
+		slots[slot] = append(slots[slot], channel)
+	}
+
+	batches := make([][]string, 0, len(slots))
+	for _, channels := range slots {
+		batches = append(batches, channels)
+	}
+
+	return batches
+}
+
+// shardedSubscription receives messages from
+// connections of all channel groups.
+type shardedSubscription struct {
+	t *shardedTransport
+
+	// ctx is canceled when subscription is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	msgs   chan *redis.Message
+	errs   chan error
+
+	mu sync.Mutex
+	// subs and chans are keyed by group of channels.
+	subs  map[string]*redis.PubSub
+	chans map[string]map[string]struct{}
+
+	confirmMu sync.Mutex
+	// confirms maps channels that are being subscribed to
+	// to channels that are closed when Redis confirms it.
+	confirms map[string]chan struct{}
+}
+
+func (s *shardedSubscription) receive(ctx context.Context) (string, string, error) {
+	select {
+	case msg := <-s.msgs:
+		return msg.Channel, msg.Payload, nil
+	case err := <-s.errs:
+		return "", "", err
+	case <-s.ctx.Done():
+		return "", "", redis.ErrClosed
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+}
+
+// subscribe subscribes to channels and waits until
+// Redis confirms subscription to each of them.
+func (s *shardedSubscription) subscribe(ctx context.Context, channels ...string) error {
+	confirmed, err := s.sendSubscribe(ctx, channels)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range confirmed {
+		select {
+		case <-ch:
+		case <-s.ctx.Done():
+			return redis.ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// sendSubscribe sends subscribe commands and returns
+// channels that are closed when subscriptions are confirmed.
+func (s *shardedSubscription) sendSubscribe(ctx context.Context, channels []string) ([]chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return nil, redis.ErrClosed
+	}
+
+	groups, err := s.t.group(ctx, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmed := make([]chan struct{}, 0, len(channels))
+	for _, channel := range channels {
+		confirmed = append(confirmed, s.waitConfirm(channel))
+	}
+
+	for group, channels := range groups {
+		sub, ok := s.subs[group]
+		if !ok {
+			sub = s.t.r.Subscribe(ctx)
+			s.subs[group] = sub
+			s.chans[group] = make(map[string]struct{})
+		}
+
+		subscribe := sub.SSubscribe
+		if s.t.adapter.ClassicPubSub {
+			subscribe = sub.Subscribe
+		}
+
+		for _, batch := range s.t.slots(channels) {
+			if err := subscribe(ctx, batch...); err != nil {
+				return nil, err
+			}
+
+			for _, channel := range batch {
+				s.chans[group][channel] = struct{}{}
+			}
+		}
+
+		// Messages are received only after subscribing,
+		// so connection is made to the node that serves channels.
+		if !ok {
+			go s.forward(sub)
+		}
+	}
+
+	return confirmed, nil
+}
+
+// waitConfirm returns channel that is closed
+// when subscription to channel is confirmed.
+func (s *shardedSubscription) waitConfirm(channel string) chan struct{} {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+
+	ch, ok := s.confirms[channel]
+	if !ok {
+		ch = make(chan struct{})
+		s.confirms[channel] = ch
+	}
+
+	return ch
+}
+
+func (s *shardedSubscription) confirm(channel string) {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+
+	if ch, ok := s.confirms[channel]; ok {
+		close(ch)
+		delete(s.confirms, channel)
+	}
+}
+
+func (s *shardedSubscription) unsubscribe(ctx context.Context, channels ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.t.group(ctx, channels)
+	if err != nil {
+		return err
+	}
+
+	for group, channels := range groups {
+		sub, ok := s.subs[group]
+		if !ok {
+			continue
+		}
+
+		for _, channel := range channels {
+			delete(s.chans[group], channel)
+		}
+
+		// Connection is closed when it has no channels.
+		if len(s.chans[group]) == 0 {
+			delete(s.subs, group)
+			delete(s.chans, group)
+			_ = sub.Close()
+
+			continue
+		}
+
+		unsubscribe := sub.SUnsubscribe
+		if s.t.adapter.ClassicPubSub {
+			unsubscribe = sub.Unsubscribe
+		}
+
+		for _, batch := range s.t.slots(channels) {
+			if err := unsubscribe(ctx, batch...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// forward forwards messages from connection until it is closed.
+func (s *shardedSubscription) forward(sub *redis.PubSub) {
+	for {
+		received, err := sub.Receive(s.ctx)
+		if err != nil {
+			s.mu.Lock()
+			closed := !s.isCurrent(sub)
+			s.mu.Unlock()
+
+			// Connections closed by unsubscribe are not errors.
+			if !closed {
+				select {
+				case s.errs <- err:
+				default:
+				}
+			}
+
+			return
+		}
+
+		msg, ok := received.(*redis.Message)
+		if !ok {
+			if sub, ok := received.(*redis.Subscription); ok && (sub.Kind == "subscribe" || sub.Kind == "ssubscribe") {
+				s.confirm(sub.Channel)
+			}
+
+			continue
+		}
+
+		select {
+		case s.msgs <- msg:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *shardedSubscription) isCurrent(sub *redis.PubSub) bool {
+	for _, current := range s.subs {
+		if current == sub {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *shardedSubscription) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cancel()
+
+	for group, sub := range s.subs {
+		delete(s.subs, group)
+		_ = sub.Close()
+	}
+
+	return nil
+}
+
+// hashSlot returns Redis Cluster hash slot of the key.
+func hashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % 16384)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,55 @@
+package socketio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedTransport_Group(t *testing.T) {
+	// Slots are served by two shards. Nodes are not connected to.
+	r := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{
+				{Start: 0, End: 8191, Nodes: []redis.ClusterNode{{Addr: "127.0.0.1:7000"}}},
+				{Start: 8192, End: 16383, Nodes: []redis.ClusterNode{{Addr: "127.0.0.1:7001"}}},
+			}, nil
+		},
+	})
+	t.Cleanup(func() { _ = r.Close() })
+
+	a := NewShardedRedisAdapter(nil, r, "", ShardByRoom)
+	transport := a.transport.(*shardedTransport)
+
+	var channels []string
+	for _, room := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		channel, _ := a.proto.roomChannel(room)
+		channels = append(channels, channel)
+	}
+
+	groups, err := transport.group(context.Background(), channels)
+	require.NoError(t, err)
+
+	// Channels are grouped by shard, not by slot.
+	require.Len(t, groups, 2)
+
+	for addr, channels := range groups {
+		for _, channel := range channels {
+			if hashSlot(channel) < 8192 {
+				assert.Equal(t, "127.0.0.1:7000", addr)
+			} else {
+				assert.Equal(t, "127.0.0.1:7001", addr)
+			}
+		}
+
+		// Each command subscribes to channels of single slot.
+		for _, batch := range transport.slots(channels) {
+			for _, channel := range batch {
+				assert.Equal(t, hashSlot(batch[0]), hashSlot(channel))
+			}
+		}
+	}
+}
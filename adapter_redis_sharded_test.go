@@ -0,0 +1,141 @@
+package socketio_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestShardedRedisAdapter(t *testing.T) {
+	for _, mode := range []socketio.ShardMode{socketio.ShardByRoom, socketio.ShardByUser} {
+		mode := mode
+		t.Run(shardModeName(mode), func(t *testing.T) {
+			adaptertest.Suite{
+				NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+					srv := miniredis.RunT(t)
+
+					adapters := make([]socketio.Adapter, len(recvrs))
+					for i, recvr := range recvrs {
+						adapters[i] = startShardedAdapter(t, newRedisClient(t, srv), mode, true, recvr)
+					}
+
+					return adapters
+				},
+			}.Run(t)
+		})
+	}
+}
+
+// TestShardedRedisAdapter_Sharded runs against Redis 7+ set with REDIS_ADDR,
+// as sharded Pub/Sub is not supported by miniredis.
+func TestShardedRedisAdapter_Sharded(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			prefix := "socketio-test:" + t.Name()
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				r := redis.NewClient(&redis.Options{Addr: addr})
+				t.Cleanup(func() { _ = r.Close() })
+
+				a := socketio.NewShardedRedisAdapter(nil, r, prefix, socketio.ShardByRoom)
+				adapters[i] = startAdapter(t, a, recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+func TestShardedRedisAdapter_Channels(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	a := startShardedAdapter(t, newRedisClient(t, srv), socketio.ShardByUser, true, adaptertest.NewReceiver())
+
+	numSub := func(channel string) int {
+		return srv.PubSubNumSub(channel)[channel]
+	}
+
+	// Only rooms of users have channels in this mode.
+	// Channel is subscribed to before socket is added.
+	a.AddSocket("s1", "s1", socketio.UserRoom("u1"), "room")
+	a.AddSocket("s2", "s2", socketio.UserRoom("u1"))
+	assert.Equal(t, 1, numSub("events:websocket#user:u1"))
+	assert.Equal(t, 1, numSub("events:websocket"))
+	assert.Zero(t, numSub("events:websocket#room"))
+
+	// Channel is kept while room has local sockets.
+	a.RemoveSocket("s1")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, numSub("events:websocket#user:u1"))
+
+	a.DelSocket("s2", socketio.UserRoom("u1"))
+	require.Eventually(t, func() bool {
+		return numSub("events:websocket#user:u1") == 0
+	}, time.Second, 5*time.Millisecond)
+
+	// Broadcast to several rooms is published to each room channel.
+	sub := r.PSubscribe(ctx, "events:websocket*")
+	t.Cleanup(func() { _ = sub.Close() })
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	packet := socketio.Packet{Type: socketio.PacketTypeEvent, Data: []byte(`["event"]`)}
+
+	require.NoError(t, a.Broadcast(ctx, packet, socketio.BroadcastOptions{
+		Rooms: []string{socketio.UserRoom("u1"), socketio.UserRoom("u2")},
+	}))
+	require.NoError(t, a.Broadcast(ctx, packet, socketio.BroadcastOptions{
+		Rooms: []string{socketio.UserRoom("u1"), "room"},
+	}))
+
+	var channels []string
+	for i := 0; i < 3; i++ {
+		msg, err := sub.ReceiveMessage(ctx)
+		require.NoError(t, err)
+
+		channels = append(channels, msg.Channel)
+	}
+
+	assert.Equal(t, []string{
+		"events:websocket#user:u1",
+		"events:websocket#user:u2",
+		"events:websocket",
+	}, channels)
+}
+
+func shardModeName(mode socketio.ShardMode) string {
+	if mode == socketio.ShardByUser {
+		return "ByUser"
+	}
+
+	return "ByRoom"
+}
+
+// startShardedAdapter creates started adapter that
+// will be closed when test ends.
+func startShardedAdapter(t *testing.T, r redis.UniversalClient, mode socketio.ShardMode, classic bool, recvr socketio.AdapterReceiver) *socketio.ShardedRedisAdapter {
+	t.Helper()
+
+	a := socketio.NewShardedRedisAdapter(nil, r, "", mode)
+	a.ClassicPubSub = classic
+	startAdapter(t, a, recvr)
+
+	return a
+}
@@ -0,0 +1,204 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+)
+
+var _ Adapter = &RedisStreamsAdapter{}
+
+const (
+	// DefaultStreamMaxLen is used if `RedisStreamsAdapter.MaxLen` is not set.
+	DefaultStreamMaxLen = 10000
+	// DefaultStreamBlockTimeout is used if `RedisStreamsAdapter.BlockTimeout` is not set.
+	DefaultStreamBlockTimeout = time.Second
+	// streamReadCount is max number of messages read at once.
+	streamReadCount = 100
+)
+
+// RedisStreamsAdapter is RedisAdapter that publishes messages
+// to Redis Stream instead of Pub/Sub channel.
+//
+// Each node remembers id of the last message it has read,
+// so after reconnecting, or after being closed and started again,
+// it receives messages that were published in the meantime.
+// Messages that were trimmed from the stream are lost.
+type RedisStreamsAdapter struct {
+	*RedisAdapter
+
+	// MaxLen is approximate number of messages kept in the stream.
+	MaxLen int64
+	// BlockTimeout is how long single read waits for new messages.
+	// Closing adapter can take that long.
+	BlockTimeout time.Duration
+}
+
+// NewRedisStreamsAdapter creates adapter that publishes messages to the stream.
+// Stream can be shared by adapters created with the same arguments only.
+func NewRedisStreamsAdapter(reg prometheus.Registerer, r redis.UniversalClient, stream string) *RedisStreamsAdapter {
+	if stream == "" {
+		stream = "events:websocket"
+	}
+
+	a := &RedisStreamsAdapter{
+		RedisAdapter: newRedisAdapter(reg, r, "redis_streams", envelopeRedisProtocol{channel: stream}),
+	}
+
+	a.transport = &streamsTransport{
+		adapter: a,
+		r:       r,
+		offsets: make(map[string]string),
+	}
+
+	return a
+}
+
+func (a *RedisStreamsAdapter) maxLen() int64 {
+	if a.MaxLen <= 0 {
+		return DefaultStreamMaxLen
+	}
+
+	return a.MaxLen
+}
+
+func (a *RedisStreamsAdapter) blockTimeout() time.Duration {
+	if a.BlockTimeout <= 0 {
+		return DefaultStreamBlockTimeout
+	}
+
+	return a.BlockTimeout
+}
+
+// streamsTransport uses Redis Streams as channels.
+type streamsTransport struct {
+	adapter *RedisStreamsAdapter
+	r       redis.UniversalClient
+
+	mu sync.Mutex
+	// offsets maps stream to id of the last read message.
+	offsets map[string]string
+}
+
+func (t *streamsTransport) publish(ctx context.Context, stream string, payload []byte) error {
+	return t.r.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: t.adapter.maxLen(),
+		Approx: true,
+		Values: map[string]any{"msg": payload},
+	}).Err()
+}
+
+// numSub returns -1, as readers of the stream are not known.
+func (t *streamsTransport) numSub(context.Context, string) (int, error) {
+	return -1, nil
+}
+
+func (t *streamsTransport) subscribe(ctx context.Context, streams, patterns []string) (redisSubscription, error) {
+	if len(patterns) != 0 {
+		return nil, errors.New("patterns are not supported by streams")
+	}
+
+	// Streams that were not read before are read
+	// starting after their current last message.
+	for _, stream := range streams {
+		if _, ok := t.offset(stream); ok {
+			continue
+		}
+
+		last, err := t.r.XRevRangeN(ctx, stream, "+", "-", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("get last message of %q: %w", stream, err)
+		}
+
+		offset := "0-0"
+		if len(last) != 0 {
+			offset = last[0].ID
+		}
+
+		t.setOffset(stream, offset)
+	}
+
+	return &streamsSubscription{t: t, streams: streams}, nil
+}
+
+func (t *streamsTransport) offset(stream string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset, ok := t.offsets[stream]
+
+	return offset, ok
+}
+
+func (t *streamsTransport) setOffset(stream, offset string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.offsets[stream] = offset
+}
+
+type streamsSubscription struct {
+	t       *streamsTransport
+	streams []string
+
+	// buf contains messages that were read, but not received yet.
+	buf []redis.XStream
+}
+
+func (s *streamsSubscription) receive(ctx context.Context) (string, string, error) {
+	for {
+		for len(s.buf) != 0 {
+			stream := &s.buf[0]
+			if len(stream.Messages) == 0 {
+				s.buf = s.buf[1:]
+				continue
+			}
+
+			msg := stream.Messages[0]
+			stream.Messages = stream.Messages[1:]
+
+			s.t.setOffset(stream.Stream, msg.ID)
+
+			payload, _ := msg.Values["msg"].(string)
+
+			return stream.Stream, payload, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return "", "", err
+		}
+
+		args := make([]string, 0, 2*len(s.streams))
+		args = append(args, s.streams...)
+		for _, stream := range s.streams {
+			offset, _ := s.t.offset(stream)
+			args = append(args, offset)
+		}
+
+		streams, err := s.t.r.XRead(ctx, &redis.XReadArgs{
+			Streams: args,
+			Count:   streamReadCount,
+			Block:   s.t.adapter.blockTimeout(),
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			return "", "", err
+		}
+
+		s.buf = streams
+	}
+}
+
+// close does nothing, as reads are limited by block timeout.
+func (s *streamsSubscription) close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package socketio_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestRedisStreamsAdapter(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			srv := miniredis.RunT(t)
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				adapters[i] = startStreamsAdapter(t, srv, recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+func TestRedisStreamsAdapter_CatchUp(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	sender := startStreamsAdapter(t, srv, adaptertest.NewReceiver())
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	a := startStreamsAdapter(t, srv, recvr)
+	a.AddSocket("s1", "s1")
+
+	broadcast := func(event string) {
+		require.NoError(t, sender.Broadcast(ctx, socketio.Packet{
+			Type: socketio.PacketTypeEvent,
+			Data: []byte(`["` + event + `"]`),
+		}, socketio.BroadcastOptions{}))
+	}
+
+	broadcast("first")
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Messages published while node is not reading are received after restart.
+	require.NoError(t, a.Close())
+	broadcast("second")
+	broadcast("third")
+	require.NoError(t, a.Start(ctx))
+
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	var events []string
+	for _, packet := range recvr.Packets("s1") {
+		events = append(events, string(packet.Data))
+	}
+
+	assert.Equal(t, []string{`["first"]`, `["second"]`, `["third"]`}, events)
+}
+
+func TestRedisStreamsAdapter_MaxLen(t *testing.T) {
+	srv := miniredis.RunT(t)
+
+	a := socketio.NewRedisStreamsAdapter(nil, newRedisClient(t, srv), "")
+	a.MaxLen = 5
+	startAdapter(t, a.RedisAdapter, adaptertest.NewReceiver())
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, a.ServerSideEmit(context.Background(), "event", nil))
+	}
+
+	n, err := newRedisClient(t, srv).XLen(context.Background(), "events:websocket").Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, n, int64(5))
+}
+
+// startStreamsAdapter creates started adapter that
+// will be closed when test ends.
+func startStreamsAdapter(t *testing.T, srv *miniredis.Miniredis, recvr socketio.AdapterReceiver) *socketio.RedisStreamsAdapter {
+	t.Helper()
+
+	a := socketio.NewRedisStreamsAdapter(nil, newRedisClient(t, srv), "")
+	a.BlockTimeout = 50 * time.Millisecond
+	// Number of nodes is known only from heartbeats,
+	// so requests may wait for timeout.
+	a.RequestTimeout = 200 * time.Millisecond
+	startAdapter(t, a.RedisAdapter, recvr)
+
+	return a
+}
@@ -0,0 +1,505 @@
+package socketio_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestRedisAdapter(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			srv := miniredis.RunT(t)
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				adapters[i] = startRedisAdapter(t, srv, recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+func TestNodeRedisAdapter(t *testing.T) {
+	adaptertest.Suite{
+		NewCluster: func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter {
+			srv := miniredis.RunT(t)
+
+			adapters := make([]socketio.Adapter, len(recvrs))
+			for i, recvr := range recvrs {
+				adapters[i] = startAdapter(t, socketio.NewNodeRedisAdapter(nil, newRedisClient(t, srv), ""), recvr)
+			}
+
+			return adapters
+		},
+	}.Run(t)
+}
+
+// TestNodeRedisAdapter_Wire checks messages in the format
+// used by Node.js @socket.io/redis-adapter.
+func TestNodeRedisAdapter_Wire(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+	recvr.Connect(socketio.SocketInfo{ID: "s2"})
+
+	a := startAdapter(t, socketio.NewNodeRedisAdapter(nil, newRedisClient(t, srv), ""), recvr)
+	a.AddSocket("s1", "s1", "room")
+	a.AddSocket("s2", "s2")
+
+	t.Run("Receive broadcast", func(t *testing.T) {
+		msg, err := msgpack.Marshal([]any{
+			"node-uid",
+			map[string]any{"type": 2, "data": []any{"hello", map[string]any{"n": 1}}, "nsp": "/"},
+			map[string]any{"rooms": []string{"room"}, "except": []string{}, "flags": map[string]any{}},
+		})
+		require.NoError(t, err)
+		require.NoError(t, r.Publish(ctx, "socket.io#/#room#", msg).Err())
+
+		require.Eventually(t, func() bool {
+			return len(recvr.Packets("s1")) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		assert.Equal(t, socketio.PacketTypeEvent, recvr.Packets("s1")[0].Type)
+		assert.JSONEq(t, `["hello",{"n":1}]`, string(recvr.Packets("s1")[0].Data))
+		assert.Empty(t, recvr.Packets("s2"))
+	})
+
+	t.Run("Publish broadcast", func(t *testing.T) {
+		sub := r.PSubscribe(ctx, "socket.io#/#*")
+		t.Cleanup(func() { _ = sub.Close() })
+		_, err := sub.Receive(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, a.Broadcast(ctx, socketio.Packet{
+			Type:      socketio.PacketTypeEvent,
+			Namespace: socketio.DefaultNamespace,
+			Data:      json.RawMessage(`["hello",{"n":1,"f":1.5}]`),
+		}, socketio.BroadcastOptions{Rooms: []string{"other"}}))
+
+		msg, err := sub.ReceiveMessage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "socket.io#/#other#", msg.Channel)
+
+		var got []any
+		require.NoError(t, msgpack.Unmarshal([]byte(msg.Payload), &got))
+		require.Len(t, got, 3)
+
+		assert.Equal(t, a.UID(), got[0])
+		assert.Equal(t, map[string]any{
+			"type": int8(2),
+			"data": []any{"hello", map[string]any{"n": int8(1), "f": 1.5}},
+			"nsp":  "/",
+		}, got[1])
+		assert.Equal(t, map[string]any{
+			"rooms":  []any{"other"},
+			"except": []any{},
+			"flags":  map[string]any{},
+		}, got[2])
+	})
+
+	t.Run("Server-side emit", func(t *testing.T) {
+		req := `{"uid":"node-uid","type":6,"data":["ping",1,"two"]}`
+		require.NoError(t, r.Publish(ctx, "socket.io-request#/#", req).Err())
+
+		require.Eventually(t, func() bool {
+			return len(recvr.ServerSideEvents()) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		event := recvr.ServerSideEvents()[0]
+		assert.Equal(t, "ping", event.Event)
+		assert.Equal(t, []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`"two"`)}, event.Args)
+	})
+
+	t.Run("Server-side emit with ack", func(t *testing.T) {
+		resp := r.Subscribe(ctx, "socket.io-response#/#")
+		t.Cleanup(func() { _ = resp.Close() })
+		_, err := resp.Receive(ctx)
+		require.NoError(t, err)
+
+		req := `{"uid":"node-uid","requestId":"req2","type":6,"data":["ping",{"n":1}]}`
+		require.NoError(t, r.Publish(ctx, "socket.io-request#/#", req).Err())
+
+		msg, err := resp.ReceiveMessage(ctx)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":6,"requestId":"req2","data":{"n":1}}`, msg.Payload)
+	})
+
+	t.Run("Remote fetch", func(t *testing.T) {
+		resp := r.Subscribe(ctx, "socket.io-response#/#")
+		t.Cleanup(func() { _ = resp.Close() })
+		_, err := resp.Receive(ctx)
+		require.NoError(t, err)
+
+		req := `{"uid":"node-uid","requestId":"req1","type":5,"opts":{"rooms":["room"],"except":[]}}`
+		require.NoError(t, r.Publish(ctx, "socket.io-request#/#", req).Err())
+
+		msg, err := resp.ReceiveMessage(ctx)
+		require.NoError(t, err)
+
+		var got struct {
+			RequestID string `json:"requestId"`
+			Sockets   []struct {
+				ID        string         `json:"id"`
+				Rooms     []string       `json:"rooms"`
+				Handshake map[string]any `json:"handshake"`
+			} `json:"sockets"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(msg.Payload), &got))
+
+		assert.Equal(t, "req1", got.RequestID)
+		require.Len(t, got.Sockets, 1)
+		assert.Equal(t, "s1", got.Sockets[0].ID)
+		assert.ElementsMatch(t, []string{"s1", "room"}, got.Sockets[0].Rooms)
+		assert.Contains(t, got.Sockets[0].Handshake, "headers")
+	})
+
+	t.Run("Remote join", func(t *testing.T) {
+		// Requests may also be MessagePack encoded.
+		req, err := msgpack.Marshal(map[string]any{
+			"type":  2,
+			"opts":  map[string]any{"rooms": []string{"s2"}, "except": []string{}},
+			"rooms": []string{"joined"},
+		})
+		require.NoError(t, err)
+		require.NoError(t, r.Publish(ctx, "socket.io-request#/#", req).Err())
+
+		require.Eventually(t, func() bool {
+			return len(a.RoomSockets("joined")) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		assert.Equal(t, []string{"s2"}, a.RoomSockets("joined"))
+	})
+}
+
+// TestNodeRedisAdapter_MixedNodes checks that requests wait for
+// Node.js servers, which do not send heartbeats, as well as Go nodes.
+func TestNodeRedisAdapter_MixedNodes(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	a := startAdapter(t, socketio.NewNodeRedisAdapter(nil, newRedisClient(t, srv), ""), adaptertest.NewReceiver())
+	a.RequestTimeout = time.Second
+
+	otherRecvr := adaptertest.NewReceiver()
+	otherRecvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	other := startAdapter(t, socketio.NewNodeRedisAdapter(nil, newRedisClient(t, srv), ""), otherRecvr)
+	other.AddSocket("s1", "s1")
+
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// Node.js server responds after Go node.
+	req := r.Subscribe(ctx, "socket.io-request#/#")
+	t.Cleanup(func() { _ = req.Close() })
+	_, err := req.Receive(ctx)
+	require.NoError(t, err)
+
+	go func() {
+		msg, err := req.ReceiveMessage(ctx)
+		if err != nil {
+			return
+		}
+
+		var got struct {
+			RequestID string `json:"requestId"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &got); err != nil {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		resp := `{"requestId":"` + got.RequestID + `","sockets":[{"id":"s2","rooms":["s2"],"handshake":{}}]}`
+		r.Publish(ctx, "socket.io-response#/#", resp)
+	}()
+
+	sockets, err := a.FetchSockets(ctx, socketio.BroadcastOptions{})
+	require.NoError(t, err)
+
+	ids := make([]string, len(sockets))
+	for i, s := range sockets {
+		ids[i] = s.ID
+	}
+	assert.ElementsMatch(t, []string{"s1", "s2"}, ids)
+}
+
+func TestRedisAdapter_SkipsOwnMessages(t *testing.T) {
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	a := startRedisAdapter(t, srv, recvr)
+	a.AddSocket("s1", "s1")
+
+	publish := func(uid, event string) {
+		data, _ := json.Marshal(socketio.PushData{
+			UID:    uid,
+			Type:   socketio.PushTypeBroadcast,
+			Packet: socketio.Packet{Type: socketio.PacketTypeEvent, Data: json.RawMessage(`["` + event + `"]`)},
+		})
+
+		require.NoError(t, r.Publish(context.Background(), "events:websocket", data).Err())
+	}
+
+	publish(a.UID(), "own")
+	publish("other-node", "other")
+
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Messages are handled in order, so own message was already skipped.
+	assert.JSONEq(t, `["other"]`, string(recvr.Packets("s1")[0].Data))
+}
+
+func TestRedisAdapter_FetchSocketsTimeout(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	a := startRedisAdapter(t, srv, recvr)
+	a.AddSocket("s1", "s1")
+	a.RequestTimeout = 50 * time.Millisecond
+
+	// Node that never responds.
+	sub := newRedisClient(t, srv).Subscribe(ctx, "events:websocket")
+	t.Cleanup(func() { _ = sub.Close() })
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	sockets, err := a.FetchSockets(ctx, socketio.BroadcastOptions{})
+	require.ErrorIs(t, err, socketio.ErrRequestTimeout)
+	assert.ErrorContains(t, err, "0 of 1 nodes responded")
+
+	// Local sockets are still returned.
+	require.Len(t, sockets, 1)
+	assert.Equal(t, "s1", sockets[0].ID)
+}
+
+func TestRedisAdapter_FetchSocketsKnownNodes(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	a := startRedisAdapter(t, srv, recvr)
+	a.RequestTimeout = 50 * time.Millisecond
+
+	otherRecvr := adaptertest.NewReceiver()
+	otherRecvr.Connect(socketio.SocketInfo{ID: "s2"})
+
+	other := startRedisAdapter(t, srv, otherRecvr)
+	other.AddSocket("s2", "s2")
+
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// Subscriber that is not a node is not waited for.
+	sub := newRedisClient(t, srv).Subscribe(ctx, "events:websocket")
+	t.Cleanup(func() { _ = sub.Close() })
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	sockets, err := a.FetchSockets(ctx, socketio.BroadcastOptions{})
+	require.NoError(t, err)
+	require.Len(t, sockets, 1)
+	assert.Equal(t, "s2", sockets[0].ID)
+}
+
+func TestRedisAdapter_Lifecycle(t *testing.T) {
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	errs := make(chan error, 16)
+
+	a := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+	a.MinReconnectBackoff = 10 * time.Millisecond
+	a.MaxReconnectBackoff = 50 * time.Millisecond
+	a.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	a.Init(adaptertest.NewReceiver())
+
+	require.NoError(t, a.Start(context.Background()))
+	require.ErrorIs(t, a.Start(context.Background()), socketio.ErrAdapterStarted)
+	assert.True(t, a.Healthy())
+
+	// Malformed message is reported.
+	require.NoError(t, r.Publish(context.Background(), "events:websocket", "not json").Err())
+	require.ErrorContains(t, <-errs, "decode message")
+
+	// Adapter resubscribes after connection is lost.
+	srv.Close()
+	require.Eventually(t, func() bool { return !a.Healthy() }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, srv.Restart())
+	require.Eventually(t, a.Healthy, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, srv.PubSubNumSub("events:websocket")["events:websocket"])
+
+	require.NoError(t, a.Close())
+	assert.False(t, a.Healthy())
+}
+
+func newRedisClient(t *testing.T, srv *miniredis.Miniredis) *redis.Client {
+	r := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { _ = r.Close() })
+
+	return r
+}
+
+// startRedisAdapter creates started adapter that
+// will be closed when test ends.
+func startRedisAdapter(t *testing.T, srv *miniredis.Miniredis, recvr socketio.AdapterReceiver) *socketio.RedisAdapter {
+	t.Helper()
+
+	return startAdapter(t, socketio.NewRedisAdapter(nil, newRedisClient(t, srv), ""), recvr)
+}
+
+// startableAdapter is implemented by RedisAdapter and adapters that embed it.
+type startableAdapter interface {
+	socketio.Adapter
+	Start(ctx context.Context) error
+	Close() error
+}
+
+// startAdapter initializes and starts adapter.
+// Adapter will be closed when test ends.
+func startAdapter[A startableAdapter](t *testing.T, a A, recvr socketio.AdapterReceiver) A {
+	t.Helper()
+
+	a.Init(recvr)
+
+	require.NoError(t, a.Start(context.Background()))
+	t.Cleanup(func() { _ = a.Close() })
+
+	return a
+}
+
+func TestEngine_ServerSideEmit(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	newEngine := func() *socketio.Engine {
+		a := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+		e := socketio.NewEngine(nil, time.Minute, time.Second, nil, nil, nil, a)
+		startAdapter(t, a, e)
+
+		return e
+	}
+
+	sender := newEngine()
+
+	received := make(chan []json.RawMessage, 1)
+	for _, e := range []*socketio.Engine{newEngine(), newEngine()} {
+		e.OnServerSide("reload", func(_ context.Context, _ string, args []json.RawMessage) (any, error) {
+			select {
+			case received <- args:
+			default:
+			}
+
+			var version int
+			if err := json.Unmarshal(args[1], &version); err != nil {
+				return nil, err
+			}
+
+			return version + 1, nil
+		})
+	}
+
+	// Requests wait for responses from nodes known from heartbeats.
+	require.Eventually(t, func() bool {
+		return len(sender.Nodes()) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, sender.ServerSideEmit(ctx, "reload", "config", 1))
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`"config"`), json.RawMessage(`1`)}, <-received)
+
+	acks, err := sender.ServerSideEmitWithAck(ctx, "reload", "config", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`3`), json.RawMessage(`3`)}, acks)
+
+	// Handler errors are returned as acknowledgements.
+	acks, err = sender.ServerSideEmitWithAck(ctx, "reload", "config", "bad")
+	require.NoError(t, err)
+	require.Len(t, acks, 2)
+	assert.Contains(t, string(acks[0]), `"error"`)
+
+	// Nodes without handler acknowledge with null.
+	acks, err = sender.ServerSideEmitWithAck(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`null`), json.RawMessage(`null`)}, acks)
+}
+
+func TestRedisAdapter_Nodes(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	a := socketio.NewRedisAdapter(nil, newRedisClient(t, srv), "")
+	a.HeartbeatInterval = 20 * time.Millisecond
+	a.HeartbeatTimeout = 100 * time.Millisecond
+	startAdapter(t, a, adaptertest.NewReceiver())
+
+	other := startRedisAdapter(t, srv, adaptertest.NewReceiver())
+
+	uids := func() []string {
+		var uids []string
+		for _, node := range a.Nodes() {
+			uids = append(uids, node.UID)
+		}
+
+		return uids
+	}
+
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{a.UID(), other.UID()}, uids())
+
+	// Closed node notifies other nodes.
+	require.NoError(t, other.Close())
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Node that stops sending heartbeats expires.
+	data, _ := json.Marshal(socketio.PushData{UID: "dead", Type: socketio.PushTypeHeartbeat})
+	require.NoError(t, r.Publish(ctx, "events:websocket", data).Err())
+
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{a.UID(), "dead"}, uids())
+
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{a.UID()}, uids())
+}
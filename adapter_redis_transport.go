@@ -0,0 +1,96 @@
+package socketio
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTransport delivers messages published by RedisAdapter
+// to adapters on other nodes.
+type redisTransport interface {
+	publish(ctx context.Context, channel string, payload []byte) error
+	// subscribe starts receiving messages from channels and patterns.
+	subscribe(ctx context.Context, channels, patterns []string) (redisSubscription, error)
+	// numSub returns number of subscribers of the channel,
+	// or negative number if it is not known.
+	numSub(ctx context.Context, channel string) (int, error)
+}
+
+// redisSubscription receives messages from subscribed channels.
+type redisSubscription interface {
+	// receive blocks until next message is received.
+	receive(ctx context.Context) (channel, payload string, err error)
+	close() error
+}
+
+// pubSubTransport uses Redis Pub/Sub.
+type pubSubTransport struct {
+	r redis.UniversalClient
+}
+
+func (t pubSubTransport) publish(ctx context.Context, channel string, payload []byte) error {
+	return t.r.Publish(ctx, channel, payload).Err()
+}
+
+func (t pubSubTransport) numSub(ctx context.Context, channel string) (int, error) {
+	res, err := t.r.PubSubNumSub(ctx, channel).Result()
+
+	return int(res[channel]), err
+}
+
+func (t pubSubTransport) subscribe(ctx context.Context, channels, patterns []string) (redisSubscription, error) {
+	sub := t.r.Subscribe(ctx)
+	if err := subscribeAll(ctx, sub, channels, patterns); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	return pubSubSubscription{sub: sub}, nil
+}
+
+type pubSubSubscription struct {
+	sub *redis.PubSub
+}
+
+func (s pubSubSubscription) receive(ctx context.Context) (string, string, error) {
+	msg, err := s.sub.ReceiveMessage(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	return msg.Channel, msg.Payload, nil
+}
+
+func (s pubSubSubscription) close() error {
+	return s.sub.Close()
+}
+
+// subscribeAll subscribes to channels and patterns and
+// waits for all subscriptions to be confirmed.
+func subscribeAll(ctx context.Context, sub *redis.PubSub, channels, patterns []string) error {
+	if len(channels) != 0 {
+		if err := sub.Subscribe(ctx, channels...); err != nil {
+			return err
+		}
+	}
+
+	if len(patterns) != 0 {
+		if err := sub.PSubscribe(ctx, patterns...); err != nil {
+			return err
+		}
+	}
+
+	for confirmed := 0; confirmed < len(channels)+len(patterns); {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := msg.(*redis.Subscription); ok {
+			confirmed++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,511 @@
+// Package adaptertest provides conformance tests
+// that any `socketio.Adapter` implementation can run.
+package adaptertest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+)
+
+// DeliveryTimeout is how long suite waits for packets to be delivered.
+var DeliveryTimeout = 2 * time.Second
+
+// Suite runs adapter conformance tests.
+type Suite struct {
+	// NewCluster creates adapter for each receiver and initializes it with
+	// that receiver. All adapters must be connected to the same cluster and
+	// ready to deliver packets when NewCluster returns.
+	NewCluster func(t *testing.T, recvrs []socketio.AdapterReceiver) []socketio.Adapter
+	// SingleNode must be set for adapters that do not deliver packets
+	// to other nodes. In this case NewCluster is always called with one receiver.
+	SingleNode bool
+}
+
+// Run runs all conformance tests.
+func (s Suite) Run(t *testing.T) {
+	t.Run("Rooms", s.testRooms)
+	t.Run("Broadcast", s.testBroadcast)
+	t.Run("FetchSockets", s.testFetchSockets)
+	t.Run("SocketsJoinLeave", s.testSocketsJoinLeave)
+	t.Run("DisconnectSockets", s.testDisconnectSockets)
+	t.Run("Nodes", s.testNodes)
+
+	if !s.SingleNode {
+		t.Run("ServerSideEmit", s.testServerSideEmit)
+		t.Run("ServerSideEmitWithAck", s.testServerSideEmitWithAck)
+		t.Run("ServerSideEmitOrder", s.testServerSideEmitOrder)
+	}
+}
+
+func (s Suite) newCluster(t *testing.T) ([]socketio.Adapter, []*Receiver) {
+	nodes := 2
+	if s.SingleNode {
+		nodes = 1
+	}
+
+	recvrs := make([]*Receiver, nodes)
+	adapterRecvrs := make([]socketio.AdapterReceiver, nodes)
+	for i := range recvrs {
+		recvrs[i] = NewReceiver()
+		adapterRecvrs[i] = recvrs[i]
+	}
+
+	adapters := s.NewCluster(t, adapterRecvrs)
+	require.Len(t, adapters, nodes)
+
+	return adapters, recvrs
+}
+
+func (s Suite) testRooms(t *testing.T) {
+	adapters, _ := s.newCluster(t)
+	a := adapters[0]
+
+	a.AddSocket("s1", "r1", "r2")
+	a.AddSocket("s1", "r3")
+	assert.ElementsMatch(t, []string{"r1", "r2", "r3"}, a.SocketRooms("s1"))
+
+	a.DelSocket("s1", "r1", "r3")
+	assert.ElementsMatch(t, []string{"r2"}, a.SocketRooms("s1"))
+
+	a.RemoveSocket("s1")
+	assert.Empty(t, a.SocketRooms("s1"))
+}
+
+func (s Suite) testBroadcast(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	// Each node has sockets in room "a", room "b" and in both rooms.
+	sockets := func(nodes int, suffixes ...string) []string {
+		var ids []string
+		for i := 0; i < nodes; i++ {
+			for _, suffix := range suffixes {
+				ids = append(ids, socketID(i, suffix))
+			}
+		}
+
+		return ids
+	}
+
+	for i, a := range adapters {
+		connectSocket(a, recvrs[i], socketID(i, "a"), "a")
+		connectSocket(a, recvrs[i], socketID(i, "b"), "b")
+		connectSocket(a, recvrs[i], socketID(i, "ab"), "a", "b")
+	}
+
+	tests := []struct {
+		name string
+		opts socketio.BroadcastOptions
+		want []string
+	}{
+		{
+			name: "All",
+			want: sockets(len(adapters), "a", "b", "ab"),
+		},
+		{
+			name: "Room",
+			opts: socketio.BroadcastOptions{Rooms: []string{"a"}},
+			want: sockets(len(adapters), "a", "ab"),
+		},
+		{
+			name: "Multiple rooms",
+			opts: socketio.BroadcastOptions{Rooms: []string{"a", "b"}},
+			want: sockets(len(adapters), "a", "b", "ab"),
+		},
+		{
+			name: "Except",
+			opts: socketio.BroadcastOptions{Rooms: []string{"a"}, Except: []string{"b"}},
+			want: sockets(len(adapters), "a"),
+		},
+		{
+			name: "Socket room",
+			opts: socketio.BroadcastOptions{Rooms: []string{socketID(len(adapters)-1, "b")}},
+			want: []string{socketID(len(adapters)-1, "b")},
+		},
+		{
+			name: "Local",
+			opts: socketio.BroadcastOptions{Flags: socketio.BroadcastFlags{Local: true}},
+			want: sockets(1, "a", "b", "ab"),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			packet := eventPacket(test.name)
+
+			require.NoError(t, adapters[0].Broadcast(context.Background(), packet, test.opts))
+
+			assert.Eventually(t, func() bool {
+				return len(received(recvrs, packet)) >= len(test.want)
+			}, DeliveryTimeout, 10*time.Millisecond)
+
+			// Wait a bit to catch duplicate or unexpected deliveries.
+			time.Sleep(50 * time.Millisecond)
+
+			assert.ElementsMatch(t, test.want, received(recvrs, packet))
+		})
+	}
+}
+
+func (s Suite) testFetchSockets(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	for i, a := range adapters {
+		connectSocket(a, recvrs[i], socketID(i, "a"), "a")
+		connectSocket(a, recvrs[i], socketID(i, "b"), "b")
+	}
+
+	t.Run("Local", func(t *testing.T) {
+		sockets, err := adapters[0].FetchSockets(context.Background(), socketio.BroadcastOptions{
+			Rooms: []string{"a"},
+			Flags: socketio.BroadcastFlags{Local: true},
+		})
+		require.NoError(t, err)
+		require.Len(t, sockets, 1)
+
+		assert.Equal(t, socketID(0, "a"), sockets[0].ID)
+		assert.Equal(t, "user-"+socketID(0, "a"), sockets[0].UserID)
+		assert.ElementsMatch(t, []string{socketID(0, "a"), "a"}, sockets[0].Rooms)
+	})
+
+	t.Run("All nodes", func(t *testing.T) {
+		sockets, err := adapters[0].FetchSockets(context.Background(), socketio.BroadcastOptions{
+			Rooms: []string{"a"},
+		})
+		require.NoError(t, err)
+		require.Len(t, sockets, len(adapters))
+
+		for _, socket := range sockets {
+			assert.Equal(t, "user-"+socket.ID, socket.UserID)
+			assert.ElementsMatch(t, []string{socket.ID, "a"}, socket.Rooms)
+		}
+	})
+}
+
+func (s Suite) testSocketsJoinLeave(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	for i, a := range adapters {
+		connectSocket(a, recvrs[i], socketID(i, "a"), "a")
+		connectSocket(a, recvrs[i], socketID(i, "b"), "b")
+	}
+
+	ctx := context.Background()
+
+	// waitRooms waits until each node has expected sockets in the room.
+	waitRooms := func(t *testing.T, room string, suffixes ...string) {
+		t.Helper()
+
+		for i, a := range adapters {
+			want := make([]string, 0, len(suffixes))
+			for _, suffix := range suffixes {
+				want = append(want, socketID(i, suffix))
+			}
+
+			assert.Eventually(t, func() bool {
+				return len(roomSockets(a, room, socketID(i, "a"), socketID(i, "b"))) == len(want)
+			}, DeliveryTimeout, 10*time.Millisecond)
+
+			assert.ElementsMatch(t, want, roomSockets(a, room, socketID(i, "a"), socketID(i, "b")))
+		}
+	}
+
+	require.NoError(t, adapters[0].AddSockets(ctx, socketio.BroadcastOptions{Rooms: []string{"a"}}, []string{"joined"}))
+	waitRooms(t, "joined", "a")
+
+	require.NoError(t, adapters[0].AddSockets(ctx, socketio.BroadcastOptions{Except: []string{"a"}}, []string{"joined"}))
+	waitRooms(t, "joined", "a", "b")
+
+	require.NoError(t, adapters[0].DelSockets(ctx, socketio.BroadcastOptions{Rooms: []string{"b"}}, []string{"joined"}))
+	waitRooms(t, "joined", "a")
+}
+
+func (s Suite) testDisconnectSockets(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	for i, a := range adapters {
+		connectSocket(a, recvrs[i], socketID(i, "a"), "a")
+		connectSocket(a, recvrs[i], socketID(i, "b"), "b")
+	}
+
+	require.NoError(t, adapters[0].DisconnectSockets(context.Background(), socketio.BroadcastOptions{
+		Rooms: []string{"b"},
+	}))
+
+	for i, recvr := range recvrs {
+		recvr := recvr
+		assert.Eventually(t, func() bool {
+			return len(recvr.Disconnected()) == 1
+		}, DeliveryTimeout, 10*time.Millisecond)
+
+		assert.Equal(t, []string{socketID(i, "b")}, recvr.Disconnected())
+	}
+}
+
+func (s Suite) testServerSideEmit(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	args := []json.RawMessage{json.RawMessage(`{"key":"value"}`), json.RawMessage(`2`)}
+	require.NoError(t, adapters[0].ServerSideEmit(context.Background(), "event", args))
+
+	for _, recvr := range recvrs[1:] {
+		recvr := recvr
+		assert.Eventually(t, func() bool {
+			return len(recvr.ServerSideEvents()) == 1
+		}, DeliveryTimeout, 10*time.Millisecond)
+
+		assert.Equal(t, []ServerSideEvent{{Event: "event", Args: args}}, recvr.ServerSideEvents())
+	}
+
+	// Wait a bit to make sure event is not delivered to sender.
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, recvrs[0].ServerSideEvents())
+}
+
+func (s Suite) testServerSideEmitWithAck(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	args := []json.RawMessage{json.RawMessage(`"ack"`)}
+	acks, err := adapters[0].ServerSideEmitWithAck(context.Background(), "event", args)
+	require.NoError(t, err)
+
+	// Receiver acknowledges event with its first argument.
+	want := make([]json.RawMessage, 0, len(recvrs)-1)
+	for range recvrs[1:] {
+		want = append(want, args[0])
+	}
+
+	assert.Equal(t, want, acks)
+	assert.Empty(t, recvrs[0].ServerSideEvents())
+}
+
+func (s Suite) testServerSideEmitOrder(t *testing.T) {
+	adapters, recvrs := s.newCluster(t)
+
+	var want []ServerSideEvent
+	for i := 0; i < 20; i++ {
+		args := []json.RawMessage{json.RawMessage(strconv.Itoa(i))}
+		require.NoError(t, adapters[0].ServerSideEmit(context.Background(), "event", args))
+
+		want = append(want, ServerSideEvent{Event: "event", Args: args})
+	}
+
+	for _, recvr := range recvrs[1:] {
+		recvr := recvr
+		assert.Eventually(t, func() bool {
+			return len(recvr.ServerSideEvents()) == len(want)
+		}, DeliveryTimeout, 10*time.Millisecond)
+
+		assert.Equal(t, want, recvr.ServerSideEvents())
+	}
+}
+
+func (s Suite) testNodes(t *testing.T) {
+	adapters, _ := s.newCluster(t)
+
+	for _, a := range adapters {
+		a := a
+		assert.Eventually(t, func() bool {
+			return len(a.Nodes()) == len(adapters)
+		}, DeliveryTimeout, 10*time.Millisecond)
+
+		uids := make(map[string]bool)
+		for _, node := range a.Nodes() {
+			uids[node.UID] = node.Self
+		}
+
+		assert.Len(t, uids, len(adapters))
+	}
+
+	// Each node reports itself with its own uid.
+	self := make(map[string]struct{})
+	for _, a := range adapters {
+		for _, node := range a.Nodes() {
+			if node.Self {
+				self[node.UID] = struct{}{}
+			}
+		}
+	}
+
+	assert.Len(t, self, len(adapters))
+}
+
+// roomSockets returns sockets that are in the room.
+func roomSockets(a socketio.Adapter, room string, socketIDs ...string) []string {
+	var res []string
+	for _, id := range socketIDs {
+		for _, socketRoom := range a.SocketRooms(id) {
+			if socketRoom == room {
+				res = append(res, id)
+			}
+		}
+	}
+
+	return res
+}
+
+func socketID(node int, suffix string) string {
+	return fmt.Sprintf("node%d-%s", node, suffix)
+}
+
+// connectSocket connects socket the same way Engine does,
+// so socket is also joined to the room with its id.
+func connectSocket(a socketio.Adapter, recvr *Receiver, id string, rooms ...string) {
+	recvr.Connect(socketio.SocketInfo{ID: id, UserID: "user-" + id})
+	a.AddSocket(id, append([]string{id}, rooms...)...)
+}
+
+func eventPacket(event string) socketio.Packet {
+	data, _ := json.Marshal([]string{event})
+
+	return socketio.Packet{
+		Type:      socketio.PacketTypeEvent,
+		Namespace: socketio.DefaultNamespace,
+		Data:      data,
+	}
+}
+
+// received returns ids of sockets that received packet.
+func received(recvrs []*Receiver, packet socketio.Packet) []string {
+	var ids []string
+	for _, recvr := range recvrs {
+		ids = append(ids, recvr.ReceivedBy(packet)...)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// ServerSideEvent is server-side event received by Receiver.
+type ServerSideEvent struct {
+	Event string
+	Args  []json.RawMessage
+}
+
+var _ socketio.AdapterReceiver = &Receiver{}
+
+// Receiver is `socketio.AdapterReceiver` that records
+// everything that adapter delivered to it.
+type Receiver struct {
+	mu           sync.Mutex
+	sockets      map[string]socketio.SocketInfo
+	packets      map[string][]socketio.Packet
+	serverSide   []ServerSideEvent
+	disconnected []string
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{
+		sockets: make(map[string]socketio.SocketInfo),
+		packets: make(map[string][]socketio.Packet),
+	}
+}
+
+// Connect adds local socket to receiver.
+func (r *Receiver) Connect(info socketio.SocketInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sockets[info.ID] = info
+}
+
+func (r *Receiver) SendLocal(packet socketio.Packet, socketIDs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range socketIDs {
+		if _, ok := r.sockets[id]; ok {
+			r.packets[id] = append(r.packets[id], packet)
+		}
+	}
+}
+
+func (r *Receiver) LocalSocket(socketID string) (socketio.SocketInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.sockets[socketID]
+
+	return info, ok
+}
+
+func (r *Receiver) DisconnectLocal(socketIDs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range socketIDs {
+		if _, ok := r.sockets[id]; ok {
+			delete(r.sockets, id)
+			r.disconnected = append(r.disconnected, id)
+		}
+	}
+}
+
+// ReceivedServerSide records the event and acknowledges it
+// with its first argument, or null if there are no arguments.
+func (r *Receiver) ReceivedServerSide(_ context.Context, event string, args []json.RawMessage) json.RawMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.serverSide = append(r.serverSide, ServerSideEvent{Event: event, Args: args})
+
+	if len(args) == 0 {
+		return json.RawMessage("null")
+	}
+
+	return args[0]
+}
+
+// Packets returns packets received by local socket.
+func (r *Receiver) Packets(socketID string) []socketio.Packet {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]socketio.Packet(nil), r.packets[socketID]...)
+}
+
+// ReceivedBy returns ids of local sockets that received packet.
+// Socket id is repeated for each time it received the packet.
+func (r *Receiver) ReceivedBy(packet socketio.Packet) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for id, packets := range r.packets {
+		for _, p := range packets {
+			if p.Type == packet.Type && string(p.Data) == string(packet.Data) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
+
+// ServerSideEvents returns received server-side events.
+func (r *Receiver) ServerSideEvents() []ServerSideEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]ServerSideEvent(nil), r.serverSide...)
+}
+
+// Disconnected returns ids of local sockets that were disconnected.
+func (r *Receiver) Disconnected() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.disconnected...)
+}
@@ -0,0 +1,105 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// BroadcastOperator emits events to sockets selected by
+// rooms, on all nodes that share the engine's adapter.
+//
+// It is immutable, so it is safe to reuse it.
+type BroadcastOperator struct {
+	engine *Engine
+	opts   BroadcastOptions
+}
+
+// To returns operator that selects sockets
+// that are in any of provided rooms.
+func (b BroadcastOperator) To(rooms ...string) BroadcastOperator {
+	b.opts.Rooms = append(b.opts.Rooms[:len(b.opts.Rooms):len(b.opts.Rooms)], rooms...)
+	return b
+}
+
+// Except returns operator that excludes sockets
+// that are in any of provided rooms.
+func (b BroadcastOperator) Except(rooms ...string) BroadcastOperator {
+	b.opts.Except = append(b.opts.Except[:len(b.opts.Except):len(b.opts.Except)], rooms...)
+	return b
+}
+
+// Local returns operator that selects only sockets
+// connected to this node.
+func (b BroadcastOperator) Local() BroadcastOperator {
+	b.opts.Flags.Local = true
+	return b
+}
+
+// Emit sends event to selected sockets.
+func (b BroadcastOperator) Emit(ctx context.Context, event string, data any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	packet, err := b.engine.eventPacket(event, data)
+	if err != nil {
+		return err
+	}
+
+	return b.engine.adapter.Broadcast(ctx, packet, b.opts)
+}
+
+// FetchSockets returns snapshots of selected sockets.
+//
+// Error may be returned together with sockets,
+// if not all nodes responded in time.
+func (b BroadcastOperator) FetchSockets(ctx context.Context) ([]RemoteSocket, error) {
+	infos, err := b.engine.adapter.FetchSockets(ctx, b.opts)
+
+	sockets := make([]RemoteSocket, len(infos))
+	for i, info := range infos {
+		sockets[i] = RemoteSocket{SocketInfo: info, engine: b.engine}
+	}
+
+	return sockets, err
+}
+
+// SocketsJoin makes selected sockets join rooms.
+func (b BroadcastOperator) SocketsJoin(ctx context.Context, rooms ...string) error {
+	return b.engine.adapter.AddSockets(ctx, b.opts, rooms)
+}
+
+// SocketsLeave makes selected sockets leave rooms.
+func (b BroadcastOperator) SocketsLeave(ctx context.Context, rooms ...string) error {
+	return b.engine.adapter.DelSockets(ctx, b.opts, rooms)
+}
+
+// DisconnectSockets disconnects selected sockets.
+func (b BroadcastOperator) DisconnectSockets(ctx context.Context) error {
+	return b.engine.adapter.DisconnectSockets(ctx, b.opts)
+}
+
+// eventPacket creates event packet with data encoded by engine's codec.
+func (e *Engine) eventPacket(event string, data any) (Packet, error) {
+	return newEventPacket(e.codec, DefaultNamespace, event, data)
+}
+
+// newEventPacket creates event packet for namespace with data encoded by codec.
+func newEventPacket(codec DataCodec, namespace, event string, data any) (Packet, error) {
+	bts, err := codec.MarashalJSON(data)
+	if err != nil {
+		return Packet{}, fmt.Errorf("encode %q event data: %w", event, err)
+	}
+
+	dataBts, err := json.Marshal([2]any{event, json.RawMessage(bts)})
+	if err != nil {
+		return Packet{}, fmt.Errorf("encode %q event: %w", event, err)
+	}
+
+	return Packet{
+		Type:      PacketTypeEvent,
+		Namespace: namespace,
+		Data:      dataBts,
+	}, nil
+}
@@ -0,0 +1,190 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastOperator(t *testing.T) {
+	e := newTestEngine()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+	e.On("join", func(_ context.Context, s *Socket, _ string, _ []byte) (any, error) {
+		s.Join("room")
+		return nil, nil
+	})
+
+	alice := connectUser(t, e, "alice")
+	bob := connectUser(t, e, "bob")
+
+	alice.ClientSend(`421["join"]`)
+	require.Equal(t, `431[null]`, alice.ClientRead(t))
+
+	ctx := context.Background()
+
+	require.NoError(t, e.To("room").Emit(ctx, "to-room", 1))
+	assert.Equal(t, `42["to-room",1]`, alice.ClientRead(t))
+
+	require.NoError(t, e.Except("room").Emit(ctx, "except-room", 2))
+	assert.Equal(t, `42["except-room",2]`, bob.ClientRead(t))
+
+	require.NoError(t, e.EmitForUser(ctx, "bob", "for-user", 3))
+	assert.Equal(t, `42["for-user",3]`, bob.ClientRead(t))
+
+	sockets, err := e.To("room").FetchSockets(ctx)
+	require.NoError(t, err)
+	require.Len(t, sockets, 1)
+	assert.Equal(t, "alice", sockets[0].UserID)
+	assert.ElementsMatch(t, []string{sockets[0].ID, UserRoom("alice"), "room"}, sockets[0].Rooms)
+
+	// Sockets can be managed through snapshots.
+	require.NoError(t, sockets[0].Emit(ctx, "remote", 5))
+	assert.Equal(t, `42["remote",5]`, alice.ClientRead(t))
+
+	require.NoError(t, sockets[0].Leave(ctx, "room"))
+	require.NoError(t, e.To("room").Emit(ctx, "to-room", 6))
+
+	// Nothing else was delivered.
+	require.NoError(t, e.Broadcast(ctx, "all", 4))
+	assert.Equal(t, `42["all",4]`, alice.ClientRead(t))
+	assert.Equal(t, `42["all",4]`, bob.ClientRead(t))
+}
+
+func connectUser(t *testing.T, e *Engine, userID string) *Conn {
+	t.Helper()
+
+	conn := NewConn()
+	e.AddClient(conn)
+	conn.ClientRead(t)
+
+	conn.ClientSend(`40` + userID)
+	require.Contains(t, conn.ClientRead(t), `40{"sid":`)
+
+	return conn
+}
+
+func TestRemoteSocket(t *testing.T) {
+	e := newTestEngine()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.SetData(map[string]string{"role": "admin"})
+		return nil, nil
+	}
+
+	conn := NewConn()
+	e.AddClient(conn)
+	conn.ClientRead(t)
+
+	conn.ClientSend(`40{"token":"abc"}`)
+	require.Contains(t, conn.ClientRead(t), `40{"sid":`)
+
+	ctx := context.Background()
+
+	sockets, err := e.FetchSockets(ctx)
+	require.NoError(t, err)
+	require.Len(t, sockets, 1)
+
+	socket := sockets[0]
+	assert.JSONEq(t, `{"token":"abc"}`, string(socket.Handshake.Auth))
+	assert.Equal(t, "127.0.0.1:1234", socket.Handshake.Address)
+	assert.False(t, socket.Handshake.Time.IsZero())
+	assert.JSONEq(t, `{"role":"admin"}`, string(socket.Data))
+
+	require.NoError(t, socket.Disconnect(ctx))
+	require.Eventually(t, func() bool {
+		sockets, err := e.FetchSockets(ctx)
+		return err == nil && len(sockets) == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestEngine_EmitForUserOrQueue(t *testing.T) {
+	e := newTestEngine()
+	e.OfflineStore = NewMemoryOfflineStore()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+
+	ctx := context.Background()
+
+	require.NoError(t, e.EmitForUserOrQueue(ctx, "alice", "first", 1))
+	require.NoError(t, e.EmitForUserOrQueue(ctx, "alice", "second", 2))
+
+	// Queued events are sent in order after connect.
+	alice := connectUser(t, e, "alice")
+	assert.Equal(t, `42["first",1]`, alice.ClientRead(t))
+	assert.Equal(t, `42["second",2]`, alice.ClientRead(t))
+
+	// Online users receive events immediately.
+	require.NoError(t, e.EmitForUserOrQueue(ctx, "alice", "third", 3))
+	assert.Equal(t, `42["third",3]`, alice.ClientRead(t))
+
+	// Queue is flushed only once.
+	second := connectUser(t, e, "alice")
+	require.NoError(t, e.Broadcast(ctx, "all", 4))
+	assert.Equal(t, `42["all",4]`, alice.ClientRead(t))
+	assert.Equal(t, `42["all",4]`, second.ClientRead(t))
+}
+
+func TestEngine_FlushOfflineFullQueue(t *testing.T) {
+	e := newTestEngine()
+	e.OfflineStore = NewMemoryOfflineStore()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+
+	ctx := context.Background()
+
+	// More events than socket's send queue holds.
+	for i := 0; i < 60; i++ {
+		require.NoError(t, e.EmitForUserOrQueue(ctx, "alice", "event", i))
+	}
+
+	alice := connectUser(t, e, "alice")
+	for i := 0; i < 60; i++ {
+		assert.Equal(t, fmt.Sprintf(`42["event",%d]`, i), alice.ClientRead(t))
+	}
+
+	msgs, err := e.OfflineStore.Take(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestEngine_FlushOfflineRequeue(t *testing.T) {
+	e := newTestEngine()
+	e.OfflineStore = NewMemoryOfflineStore()
+
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, e.EmitForUserOrQueue(ctx, "alice", "event", i))
+	}
+
+	var sent []string
+	err := e.flushOffline(ctx, "alice", func(packet Packet) error {
+		if len(sent) == 1 {
+			return errors.New("send failed")
+		}
+
+		sent = append(sent, string(packet.Data))
+
+		return nil
+	})
+	require.ErrorContains(t, err, "send failed")
+	assert.Equal(t, []string{`["event",1]`}, sent)
+
+	// Events that were not sent are queued again in order.
+	msgs, err := e.OfflineStore.Take(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.JSONEq(t, `["event",2]`, string(msgs[0].Data))
+	assert.JSONEq(t, `["event",3]`, string(msgs[1].Data))
+}
@@ -0,0 +1,157 @@
+package socketio
+
+import (
+	"sync"
+)
+
+// DispatchMode defines how events received from single socket are handled.
+type DispatchMode int
+
+const (
+	// DispatchSequential handles events one by one
+	// on socket's read goroutine. Slow handler will
+	// stall all further events from the same client.
+	DispatchSequential DispatchMode = iota
+	// DispatchConcurrent handles events concurrently,
+	// with at most `Engine.SocketWorkers` events per socket.
+	// Events can be handled in any order.
+	DispatchConcurrent
+	// DispatchOrderedPerEvent handles events with the same name
+	// in order they were received, while events with different names
+	// are handled concurrently.
+	DispatchOrderedPerEvent
+)
+
+// DefaultSocketWorkers is used if `Engine.SocketWorkers` is not set.
+const DefaultSocketWorkers = 4
+
+// dispatcher runs event handlers for single socket
+// according to engine's dispatch mode.
+type dispatcher struct {
+	engine *Engine
+	mode   DispatchMode
+
+	// pending limits number of events that are
+	// queued or handled at the same time for the socket.
+	pending chan struct{}
+
+	mu     sync.Mutex
+	queues map[string]*eventQueue
+}
+
+type eventQueue struct {
+	tasks   []func()
+	running bool
+}
+
+func (e *Engine) newDispatcher() *dispatcher {
+	workers := e.SocketWorkers
+	if workers <= 0 {
+		workers = DefaultSocketWorkers
+	}
+
+	d := &dispatcher{
+		engine: e,
+		mode:   e.DispatchMode,
+	}
+
+	if d.mode != DispatchSequential {
+		d.pending = make(chan struct{}, workers)
+	}
+
+	if d.mode == DispatchOrderedPerEvent {
+		d.queues = make(map[string]*eventQueue)
+	}
+
+	return d
+}
+
+// dispatch runs task for event according to dispatch mode.
+//
+// In non-sequential modes it blocks while socket
+// already has maximum number of pending events.
+func (d *dispatcher) dispatch(event string, task func()) {
+	d.engine.metrics.HandlerQueueDepth.Inc()
+
+	switch d.mode {
+	case DispatchConcurrent:
+		d.pending <- struct{}{}
+
+		go func() {
+			defer func() { <-d.pending }()
+
+			d.run(task)
+		}()
+	case DispatchOrderedPerEvent:
+		d.pending <- struct{}{}
+
+		d.mu.Lock()
+		q := d.queues[event]
+		if q == nil {
+			q = &eventQueue{}
+			d.queues[event] = q
+		}
+
+		q.tasks = append(q.tasks, task)
+		if q.running {
+			d.mu.Unlock()
+			return
+		}
+
+		q.running = true
+		d.mu.Unlock()
+
+		go d.runQueue(event, q)
+	default:
+		d.run(task)
+	}
+}
+
+func (d *dispatcher) runQueue(event string, q *eventQueue) {
+	for {
+		d.mu.Lock()
+		if len(q.tasks) == 0 {
+			q.running = false
+			delete(d.queues, event)
+			d.mu.Unlock()
+
+			return
+		}
+
+		task := q.tasks[0]
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		d.mu.Unlock()
+
+		d.run(task)
+		<-d.pending
+	}
+}
+
+// run executes task respecting global handler concurrency limit.
+func (d *dispatcher) run(task func()) {
+	e := d.engine
+
+	if sem := e.handlersSemaphore(); sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+
+	e.metrics.HandlerQueueDepth.Dec()
+	e.metrics.HandlersInFlight.Inc()
+	defer e.metrics.HandlersInFlight.Dec()
+
+	task()
+}
+
+// handlersSemaphore returns semaphore for global handler concurrency limit
+// or nil if there is no limit.
+func (e *Engine) handlersSemaphore() chan struct{} {
+	e.handlersSemOnce.Do(func() {
+		if e.MaxConcurrentHandlers > 0 {
+			e.handlersSem = make(chan struct{}, e.MaxConcurrentHandlers)
+		}
+	})
+
+	return e.handlersSem
+}
@@ -0,0 +1,61 @@
+package socketio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name string
+		mode DispatchMode
+		send []string
+		want []string
+	}{
+		{
+			name: "Concurrent",
+			mode: DispatchConcurrent,
+			send: []string{`421["slow"]`, `422["fast"]`},
+			want: []string{`432["fast"]`, `431["slow"]`},
+		},
+		{
+			name: "Ordered per event",
+			mode: DispatchOrderedPerEvent,
+			send: []string{`421["slow"]`, `422["slow"]`, `423["fast"]`},
+			want: []string{`433["fast"]`, `431["slow"]`, `432["slow"]`},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			release := make(chan struct{})
+
+			e := newTestEngine()
+			e.DispatchMode = test.mode
+			e.MaxConcurrentHandlers = 2
+			e.On("slow", func(ctx context.Context, _ *Socket, event string, _ []byte) (any, error) {
+				<-release
+				return event, nil
+			})
+			e.On("fast", func(ctx context.Context, _ *Socket, event string, _ []byte) (any, error) {
+				return event, nil
+			})
+
+			conn := connectClient(t, e)
+			for _, msg := range test.send {
+				conn.ClientSend(msg)
+			}
+
+			assert.Equal(t, test.want[0], conn.ClientRead(t))
+
+			close(release)
+
+			for _, want := range test.want[1:] {
+				assert.Equal(t, want, conn.ClientRead(t))
+			}
+		})
+	}
+}
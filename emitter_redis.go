@@ -0,0 +1,171 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ AdapterSender = Emitter{}
+
+// EmitterUID is uid embedded in messages published by Emitter.
+const EmitterUID = "emitter"
+
+// Emitter publishes events to sockets connected to nodes that use RedisAdapter,
+// without running an Engine. It does not receive anything from Redis.
+//
+// Rooms and namespace are selected the same way as with `BroadcastOperator`.
+// Emitter is immutable, so it is safe to reuse it.
+type Emitter struct {
+	r        redis.UniversalClient
+	codec    DataCodec
+	newProto func(nsp string) redisProtocol
+
+	nsp  string
+	opts BroadcastOptions
+}
+
+// NewRedisEmitter creates emitter for adapters created
+// with `NewRedisAdapter` and the same events channel.
+//
+// If codec is nil - JSON codec will be used.
+func NewRedisEmitter(r redis.UniversalClient, eventsChannel string, codec DataCodec) Emitter {
+	if eventsChannel == "" {
+		eventsChannel = "events:websocket"
+	}
+
+	return newEmitter(r, codec, func(string) redisProtocol {
+		return envelopeRedisProtocol{channel: eventsChannel}
+	})
+}
+
+// NewNodeRedisEmitter creates emitter for adapters created with
+// `NewNodeRedisAdapter` and the same key. It also can be used with
+// Node.js servers that use @socket.io/redis-adapter.
+//
+// If codec is nil - JSON codec will be used.
+func NewNodeRedisEmitter(r redis.UniversalClient, key string, codec DataCodec) Emitter {
+	if key == "" {
+		key = DefaultNodeRedisKey
+	}
+
+	return newEmitter(r, codec, func(nsp string) redisProtocol {
+		return newNodeRedisProtocol(key, nsp)
+	})
+}
+
+func newEmitter(r redis.UniversalClient, codec DataCodec, newProto func(nsp string) redisProtocol) Emitter {
+	if codec == nil {
+		codec = NewJSONCodec()
+	}
+
+	return Emitter{
+		r:        r,
+		codec:    codec,
+		newProto: newProto,
+		nsp:      DefaultNamespace,
+	}
+}
+
+// Of returns emitter for namespace.
+func (e Emitter) Of(nsp string) Emitter {
+	e.nsp = nsp
+	return e
+}
+
+// To returns emitter that selects sockets
+// that are in any of provided rooms.
+func (e Emitter) To(rooms ...string) Emitter {
+	e.opts.Rooms = append(e.opts.Rooms[:len(e.opts.Rooms):len(e.opts.Rooms)], rooms...)
+	return e
+}
+
+// ForUser returns emitter that selects sockets
+// of any of provided users.
+func (e Emitter) ForUser(userIDs ...string) Emitter {
+	rooms := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		rooms[i] = UserRoom(userID)
+	}
+
+	return e.To(rooms...)
+}
+
+// Except returns emitter that excludes sockets
+// that are in any of provided rooms.
+func (e Emitter) Except(rooms ...string) Emitter {
+	e.opts.Except = append(e.opts.Except[:len(e.opts.Except):len(e.opts.Except)], rooms...)
+	return e
+}
+
+// Emit sends event to selected sockets.
+func (e Emitter) Emit(ctx context.Context, event string, data any) error {
+	packet, err := newEventPacket(e.codec, e.nsp, event, data)
+	if err != nil {
+		return err
+	}
+
+	return e.publish(ctx, PushData{
+		Type:   PushTypeBroadcast,
+		Packet: packet,
+		Opts:   e.opts,
+	})
+}
+
+// Broadcast sends event to all sockets.
+// Rooms selected on emitter are ignored.
+func (e Emitter) Broadcast(ctx context.Context, event string, data any) error {
+	e.opts = BroadcastOptions{}
+
+	return e.Emit(ctx, event, data)
+}
+
+// EmitForUser sends event to all sockets of the user.
+// Rooms selected on emitter are ignored.
+func (e Emitter) EmitForUser(ctx context.Context, userID, event string, data any) error {
+	e.opts = BroadcastOptions{}
+
+	return e.ForUser(userID).Emit(ctx, event, data)
+}
+
+// SocketsJoin makes selected sockets join rooms.
+func (e Emitter) SocketsJoin(ctx context.Context, rooms ...string) error {
+	return e.publish(ctx, PushData{
+		Type:  PushTypeSocketsJoin,
+		Opts:  e.opts,
+		Rooms: rooms,
+	})
+}
+
+// SocketsLeave makes selected sockets leave rooms.
+func (e Emitter) SocketsLeave(ctx context.Context, rooms ...string) error {
+	return e.publish(ctx, PushData{
+		Type:  PushTypeSocketsLeave,
+		Opts:  e.opts,
+		Rooms: rooms,
+	})
+}
+
+// DisconnectSockets closes selected sockets.
+func (e Emitter) DisconnectSockets(ctx context.Context) error {
+	return e.publish(ctx, PushData{
+		Type: PushTypeDisconnectSockets,
+		Opts: e.opts,
+	})
+}
+
+func (e Emitter) publish(ctx context.Context, data PushData) error {
+	data.UID = EmitterUID
+
+	channel, bts, err := e.newProto(e.nsp).encode(envelope{}, data)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+
+	if err := e.r.Publish(ctx, channel, bts).Err(); err != nil {
+		return fmt.Errorf("publish message: %w", err)
+	}
+
+	return nil
+}
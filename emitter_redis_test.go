@@ -0,0 +1,142 @@
+package socketio_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+	"github.com/ffenix113/go-socketio/adaptertest"
+)
+
+func TestEmitter(t *testing.T) {
+	tests := []struct {
+		name       string
+		newAdapter func(r redis.UniversalClient) *socketio.RedisAdapter
+		newEmitter func(r redis.UniversalClient) socketio.Emitter
+	}{
+		{
+			name: "JSON",
+			newAdapter: func(r redis.UniversalClient) *socketio.RedisAdapter {
+				return socketio.NewRedisAdapter(nil, r, "")
+			},
+			newEmitter: func(r redis.UniversalClient) socketio.Emitter {
+				return socketio.NewRedisEmitter(r, "", nil)
+			},
+		},
+		{
+			name: "Node",
+			newAdapter: func(r redis.UniversalClient) *socketio.RedisAdapter {
+				return socketio.NewNodeRedisAdapter(nil, r, "")
+			},
+			newEmitter: func(r redis.UniversalClient) socketio.Emitter {
+				return socketio.NewNodeRedisEmitter(r, "", nil)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := miniredis.RunT(t)
+
+			recvr := adaptertest.NewReceiver()
+			a := startAdapter(t, test.newAdapter(newRedisClient(t, srv)), recvr)
+
+			for _, s := range []socketio.SocketInfo{{ID: "s1", UserID: "u1"}, {ID: "s2", UserID: "u2"}} {
+				recvr.Connect(s)
+				a.AddSocket(s.ID, s.ID, socketio.UserRoom(s.UserID), "room")
+			}
+
+			emitter := test.newEmitter(newRedisClient(t, srv))
+
+			// waitPacket waits for event to be delivered to sockets.
+			waitPacket := func(t *testing.T, event string, want ...string) {
+				t.Helper()
+
+				packet := socketio.Packet{Type: socketio.PacketTypeEvent, Data: []byte(`["` + event + `",null]`)}
+				require.Eventually(t, func() bool {
+					return len(recvr.ReceivedBy(packet)) >= len(want)
+				}, time.Second, 5*time.Millisecond)
+
+				assert.ElementsMatch(t, want, recvr.ReceivedBy(packet))
+			}
+
+			require.NoError(t, emitter.Broadcast(ctx, "all", nil))
+			waitPacket(t, "all", "s1", "s2")
+
+			require.NoError(t, emitter.EmitForUser(ctx, "u2", "user", nil))
+			waitPacket(t, "user", "s2")
+
+			require.NoError(t, emitter.To("room").Except("s1").Emit(ctx, "room", nil))
+			waitPacket(t, "room", "s2")
+
+			require.NoError(t, emitter.ForUser("u1").SocketsJoin(ctx, "joined"))
+			require.Eventually(t, func() bool {
+				return len(a.RoomSockets("joined")) == 1
+			}, time.Second, 5*time.Millisecond)
+			assert.Equal(t, []string{"s1"}, a.RoomSockets("joined"))
+
+			require.NoError(t, emitter.To("joined").SocketsLeave(ctx, "joined"))
+			require.Eventually(t, func() bool {
+				return len(a.RoomSockets("joined")) == 0
+			}, time.Second, 5*time.Millisecond)
+
+			require.NoError(t, emitter.ForUser("u2").DisconnectSockets(ctx))
+			require.Eventually(t, func() bool {
+				return len(recvr.Disconnected()) == 1
+			}, time.Second, 5*time.Millisecond)
+			assert.Equal(t, []string{"s2"}, recvr.Disconnected())
+		})
+	}
+}
+
+func TestEmitter_Namespace(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	r := newRedisClient(t, srv)
+
+	sub := r.PSubscribe(ctx, "socket.io#*")
+	t.Cleanup(func() { _ = sub.Close() })
+	_, err := sub.Receive(ctx)
+	require.NoError(t, err)
+
+	emitter := socketio.NewNodeRedisEmitter(r, "", nil)
+	require.NoError(t, emitter.Of("/admin").To("room").Emit(ctx, "event", nil))
+
+	msg, err := sub.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "socket.io#/admin#room#", msg.Channel)
+}
+
+func TestEmitter_NamespaceIgnored(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	recvr := adaptertest.NewReceiver()
+	recvr.Connect(socketio.SocketInfo{ID: "s1"})
+
+	a := startRedisAdapter(t, srv, recvr)
+	a.AddSocket("s1", "s1", "room")
+
+	emitter := socketio.NewRedisEmitter(newRedisClient(t, srv), "", nil)
+	require.NoError(t, emitter.Of("/admin").To("room").Emit(ctx, "admin", nil))
+	// Marker is published after event, so event would be received before it.
+	require.NoError(t, emitter.To("room").Emit(ctx, "marker", nil))
+
+	require.Eventually(t, func() bool {
+		return len(recvr.Packets("s1")) != 0
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, []socketio.Packet{{
+		Type:      socketio.PacketTypeEvent,
+		Namespace: socketio.DefaultNamespace,
+		Data:      []byte(`["marker",null]`),
+	}}, recvr.Packets("s1"))
+}
@@ -3,8 +3,10 @@ package socketio
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,6 +19,9 @@ const (
 	// if no handlers are registered for received event type.
 	CatchAllEvent    = "*"
 	DefaultNamespace = "/"
+
+	// DefaultMaxInvalidPackets is used if `Engine.MaxInvalidPackets` is not set.
+	DefaultMaxInvalidPackets = 10
 )
 
 type DataCodec interface {
@@ -24,48 +29,147 @@ type DataCodec interface {
 	UnmarshalJSONTo(data []byte, to any) error
 }
 
+var (
+	_ AdapterSender   = &Engine{}
+	_ AdapterReceiver = &Engine{}
+)
+
 type Engine struct {
 	ioEngine *engineio.Engine
 
-	codec DataCodec
+	codec   DataCodec
+	adapter Adapter
 
-	mu              sync.RWMutex
-	userIDToSockets map[string][]*Socket
-	engineToSocket  map[*engineio.Socket]*Socket
+	mu             sync.RWMutex
+	sockets        map[string]*Socket
+	engineToSocket map[*engineio.Socket]*Socket
 
-	handlers map[string]SocketEventHandler
+	handlers           map[string]SocketEventHandler
+	serverSideHandlers map[string]ServerSideHandler
+	middlewares        []Middleware
 
 	OnConnect    SocketEventHandler
 	OnDisconnect SocketEventHandler
 
+	// OnError is called when client sends packet that
+	// can not be handled or when event handler panics with `*PanicError`.
+	// It is called from goroutine that handles socket's packets,
+	// so it should not block. Socket is nil if server-side handler panicked.
+	OnError func(s *Socket, err error)
+	// DisconnectOnPanic defines if socket should be disconnected
+	// after its event handler panicked. By default socket is kept alive.
+	DisconnectOnPanic bool
+	// MaxInvalidPackets is number of invalid packets after which
+	// client will be disconnected. If not set `DefaultMaxInvalidPackets` is used.
+	// Negative value disables disconnection.
+	MaxInvalidPackets int
+
+	// HandlerTimeout is a deadline for context of each handler call.
+	// Zero value means that handler context has no deadline,
+	// but it will still be canceled when socket disconnects.
+	HandlerTimeout time.Duration
+
+	// DispatchMode defines how events from single socket are handled.
+	// It is applied to sockets that connect after it is set.
+	DispatchMode DispatchMode
+	// SocketWorkers is maximum number of events that can be
+	// queued or handled concurrently for single socket
+	// in non-sequential dispatch modes.
+	// If not set `DefaultSocketWorkers` is used.
+	SocketWorkers int
+	// MaxConcurrentHandlers limits number of event handlers
+	// running at the same time across all sockets.
+	// Zero value means no limit. It must be set before first event is handled.
+	MaxConcurrentHandlers int
+
+	// Presence tracks users that are online on any node.
+	// If it is set, sockets of users are added to it on connect
+	// and removed on disconnect. It must be set before clients connect.
+	Presence *Presence
+	// OfflineStore keeps events emitted with `EmitForUserOrQueue`
+	// for users that are offline. Queued events are sent to the
+	// next socket of the user that connects.
+	// It must be set before clients connect.
+	OfflineStore OfflineStore
+
+	// ReliableTimeout is how long reliable messages are resent
+	// until client acknowledges them.
+	// If not set `DefaultReliableTimeout` is used.
+	ReliableTimeout time.Duration
+	// ReliableRetryInterval is delay before the first resend of
+	// reliable message. It is doubled after each resend.
+	// If not set `DefaultReliableRetryInterval` is used.
+	ReliableRetryInterval time.Duration
+	// ReliableMaxRetryInterval limits delay between resends.
+	// If not set `DefaultReliableMaxRetryInterval` is used.
+	ReliableMaxRetryInterval time.Duration
+	// OnDelivery is called when delivery of reliable message
+	// is finished, successfully or not. It should not block.
+	OnDelivery func(report DeliveryReport)
+
+	// ShutdownEvent is emitted to all sockets of this node
+	// when `Shutdown` is called, before they are closed.
+	// If empty - no event is emitted.
+	ShutdownEvent string
+
+	reliableMu sync.Mutex
+	reliable   map[int]*reliableMessage
+
+	// closing is set when shutdown starts. It is guarded by mu.
+	closing bool
+	// closed is closed when pending reliable messages should be canceled.
+	closed   chan struct{}
+	inFlight sync.WaitGroup
+
+	handlersSemOnce sync.Once
+	handlersSem     chan struct{}
+
 	metrics *Metrics
 }
 
-func NewEngine(reg prometheus.Registerer, pingInterval, pingTimeout time.Duration, read engineio.ReadBytes, write engineio.WriteBytes, codec DataCodec) *Engine {
+// NewEngine creates new engine.
+//
+// If codec is nil - JSON codec is used.
+// If adapter is nil - MemoryAdapter is used, so events
+// are delivered only to sockets connected to this engine.
+func NewEngine(reg prometheus.Registerer, pingInterval, pingTimeout time.Duration, read engineio.ReadBytes, write engineio.WriteBytes, codec DataCodec, adapter Adapter) *Engine {
 	if codec == nil {
 		codec = NewJSONCodec()
 	}
 
-	var noopHandler SocketEventHandler = func(s *Socket, event string, data []byte) (any, error) {
+	if adapter == nil {
+		adapter = NewMemoryAdapter()
+	}
+
+	var noopHandler SocketEventHandler = func(ctx context.Context, s *Socket, event string, data []byte) (any, error) {
 		return nil, nil
 	}
 
 	e := &Engine{
-		userIDToSockets: make(map[string][]*Socket),
-		engineToSocket:  make(map[*engineio.Socket]*Socket),
+		sockets:        make(map[string]*Socket),
+		engineToSocket: make(map[*engineio.Socket]*Socket),
 
-		codec: codec,
+		codec:   codec,
+		adapter: adapter,
 
-		handlers:     make(map[string]SocketEventHandler),
-		OnConnect:    noopHandler,
-		OnDisconnect: noopHandler,
+		handlers:           make(map[string]SocketEventHandler),
+		serverSideHandlers: make(map[string]ServerSideHandler),
+		OnConnect:          noopHandler,
+		OnDisconnect:       noopHandler,
 
+		closed:  make(chan struct{}),
 		metrics: NewMetrics(reg),
 	}
 
+	e.serverSideHandlers[reliableAckEvent] = e.handleRemoteAck
+	e.serverSideHandlers[socketCountEvent] = e.handleSocketCount
+	e.serverSideHandlers[presenceEvent] = e.handlePresence
+
 	e.ioEngine = engineio.NewEngine(reg, pingInterval, pingTimeout, read, write, e.ioPacketHandler)
 	e.ioEngine.OnDisconnect = e.onDisconnect
 
+	adapter.Init(e)
+
 	return e
 }
 
@@ -73,29 +177,44 @@ func (e *Engine) GetCodec() DataCodec {
 	return e.codec
 }
 
+func (e *Engine) Adapter() Adapter {
+	return e.adapter
+}
+
 // AddClient creates and stores Socket.
+// If engine is shut down - connection is closed and nil is returned.
 //
 // TODO: Better init handshake. Wait for client to send connect & auth before moving forward.
 func (e *Engine) AddClient(conn net.Conn) *engineio.Socket {
+	// Lock is held while creating client, so that packets
+	// read by the client are not handled before socket is stored.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closing {
+		_ = conn.Close()
+		return nil
+	}
+
 	cl := e.ioEngine.NewClient(conn)
 	if cl == nil {
 		return nil
 	}
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	socket := e.NewSocket(cl)
+	socket.Handshake.Time = time.Now()
+	socket.Handshake.Issued = socket.Handshake.Time.UnixMilli()
+	if addr := conn.RemoteAddr(); addr != nil {
+		socket.Handshake.Address = addr.String()
+	}
 
-	e.engineToSocket[cl] = e.NewSocket(cl)
+	e.engineToSocket[cl] = socket
+	e.sockets[socket.ID] = socket
 
 	return cl
 }
 
-func (e *Engine) addToNamespace(ioSocket *engineio.Socket, namespace string) {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	socket := e.engineToSocket[ioSocket]
-
+func (e *Engine) addToNamespace(socket *Socket, namespace string) {
 	if namespace != DefaultNamespace {
 		e.writeToClient(socket, Packet{
 			Type:      PacketTypeConnectError,
@@ -113,7 +232,7 @@ func (e *Engine) addToNamespace(ioSocket *engineio.Socket, namespace string) {
 	e.writeToClient(socket, Packet{
 		Type:      PacketTypeConnect,
 		Namespace: DefaultNamespace,
-		Data:      Marshal(connData{SID: engineio.SocketID}),
+		Data:      Marshal(connData{SID: socket.ID}),
 	})
 }
 
@@ -130,17 +249,10 @@ func (e *Engine) RemoveSocketUnsafe(ioSocket *engineio.Socket) *Socket {
 		return nil
 	}
 
-	sockets := e.userIDToSockets[socket.UserID]
-	for i, s := range sockets {
-		if s == socket {
-			sockets = append(sockets[:i], sockets[i+1:]...)
-			e.userIDToSockets[socket.UserID] = sockets
-
-			break
-		}
-	}
-
 	delete(e.engineToSocket, ioSocket)
+	delete(e.sockets, socket.ID)
+
+	e.adapter.RemoveSocket(socket.ID)
 
 	return socket
 }
@@ -152,121 +264,273 @@ func (e *Engine) On(event string, handler SocketEventHandler) {
 	e.handlers[event] = handler
 }
 
-func (e *Engine) Broadcast(_ context.Context, event string, data any) error {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
-
-	if len(e.engineToSocket) == 0 {
-		return nil
-	}
-
-	bts, _ := e.codec.MarashalJSON(data)
-	dataBts, _ := json.Marshal([2]any{event, json.RawMessage(bts)})
+// Use adds middlewares that will wrap every event handler
+// added with `On`. Middlewares are called in order they were added.
+//
+// OnConnect and OnDisconnect are not wrapped.
+func (e *Engine) Use(middlewares ...Middleware) {
+	e.middlewares = append(e.middlewares, middlewares...)
+}
 
-	packet := Packet{
-		Type:      PacketTypeEvent,
-		Namespace: DefaultNamespace,
-		Data:      dataBts,
-	}
+// To returns operator that emits events to sockets
+// in any of provided rooms.
+func (e *Engine) To(rooms ...string) BroadcastOperator {
+	return BroadcastOperator{engine: e}.To(rooms...)
+}
 
-	for _, socket := range e.engineToSocket {
-		e.writeToClient(socket, packet)
-	}
+// Except returns operator that emits events to all sockets
+// except those in any of provided rooms.
+func (e *Engine) Except(rooms ...string) BroadcastOperator {
+	return BroadcastOperator{engine: e}.Except(rooms...)
+}
 
-	return nil
+// Broadcast emits event to all sockets.
+func (e *Engine) Broadcast(ctx context.Context, event string, data any) error {
+	return BroadcastOperator{engine: e}.Emit(ctx, event, data)
 }
 
 // EmitForUser emits provided event to all sockets
-// for this user connected to this engine.
+// of this user.
 //
 // It is only useful if `UserID` field is set on socket.
-func (e *Engine) EmitForUser(_ context.Context, userID, event string, data any) error {
+func (e *Engine) EmitForUser(ctx context.Context, userID, event string, data any) error {
 	e.metrics.EmitForUserCalls.Inc()
 
+	return e.To(UserRoom(userID)).Emit(ctx, event, data)
+}
+
+// FetchSockets returns all sockets.
+func (e *Engine) FetchSockets(ctx context.Context) ([]RemoteSocket, error) {
+	return BroadcastOperator{engine: e}.FetchSockets(ctx)
+}
+
+// SocketsJoin makes all sockets join rooms.
+func (e *Engine) SocketsJoin(ctx context.Context, rooms ...string) error {
+	return BroadcastOperator{engine: e}.SocketsJoin(ctx, rooms...)
+}
+
+// SocketsLeave makes all sockets leave rooms.
+func (e *Engine) SocketsLeave(ctx context.Context, rooms ...string) error {
+	return BroadcastOperator{engine: e}.SocketsLeave(ctx, rooms...)
+}
+
+// DisconnectSockets disconnects all sockets.
+func (e *Engine) DisconnectSockets(ctx context.Context) error {
+	return BroadcastOperator{engine: e}.DisconnectSockets(ctx)
+}
+
+// Nodes returns live nodes that share the adapter, including this one.
+func (e *Engine) Nodes() []NodeInfo {
+	return e.adapter.Nodes()
+}
+
+// SendLocal is used for adapter only.
+func (e *Engine) SendLocal(packet Packet, socketIDs ...string) {
+	if len(socketIDs) == 0 {
+		return
+	}
+
+	data, _ := packet.MarshalBinary()
+
+	ioPacket := engineio.Packet{
+		Type: engineio.PacketTypeMessage,
+		Data: data,
+	}
+
+	// Only reliable events are sent to clients with ack id.
+	reliable := packet.Type == PacketTypeEvent && packet.AckID != nil
+	now := time.Now()
+
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	sockets, ok := e.userIDToSockets[userID]
-	if !ok {
-		return nil
+	for _, id := range socketIDs {
+		if socket, ok := e.sockets[id]; ok {
+			if reliable {
+				socket.sentReliable(*packet.AckID, now, e.reliableTimeout())
+			}
+
+			e.ioEngine.Send(socket.cl, ioPacket)
+		}
 	}
+}
 
-	bts, _ := e.codec.MarashalJSON(data)
-	dataBts, _ := json.Marshal([2]any{event, json.RawMessage(bts)})
+// LocalSocket is used for adapter only.
+func (e *Engine) LocalSocket(socketID string) (SocketInfo, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	packet := Packet{
-		Type:      PacketTypeEvent,
-		Namespace: DefaultNamespace,
-		Data:      dataBts,
+	socket, ok := e.sockets[socketID]
+	if !ok {
+		return SocketInfo{}, false
 	}
 
-	for _, socket := range sockets {
-		e.writeToClient(socket, packet)
+	info := SocketInfo{
+		ID:        socket.ID,
+		UserID:    socket.UserID,
+		Handshake: socket.Handshake,
 	}
 
-	return nil
+	if data := socket.Data(); data != nil {
+		info.Data, _ = e.codec.MarashalJSON(data)
+	}
+
+	return info, true
 }
 
-// ReceivedNew is used for adapter only.
-//
-// This method should not be used anywhere in the code
-// apart from adapter implementation.
-func (e *Engine) ReceivedNew(ctx context.Context, userID, event string, data json.RawMessage) {
-	if userID != "" {
-		e.EmitForUser(ctx, userID, event, data)
-		return
+// DisconnectLocal is used for adapter only.
+func (e *Engine) DisconnectLocal(socketIDs ...string) {
+	e.mu.RLock()
+	sockets := make([]*Socket, 0, len(socketIDs))
+	for _, id := range socketIDs {
+		if socket, ok := e.sockets[id]; ok {
+			sockets = append(sockets, socket)
+		}
 	}
+	e.mu.RUnlock()
 
-	e.Broadcast(ctx, event, data)
+	// Sockets are closed without lock, as closing
+	// removes socket from the engine.
+	for _, socket := range sockets {
+		socket.Close()
+	}
 }
 
 func (e *Engine) onDisconnect(ioSocket *engineio.Socket) {
 	// FIXME: This should not check for nil,
 	// but currently this can be called multiple times for single client.
 	if socket := e.RemoveSocket(ioSocket); socket != nil {
-		socket.Close()
-		e.OnDisconnect(socket, "", nil)
+		socket.cancel()
+
+		// Socket context is already canceled at this point,
+		// so disconnect handler receives new one.
+		ctx, cancel := e.handlerContext(context.WithValue(context.Background(), socketContextKey{}, socket))
+		defer cancel()
+
+		if e.Presence != nil && socket.UserID != "" {
+			if err := e.Presence.disconnected(ctx, socket.UserID, socket.ID); err != nil {
+				e.reportError(socket, err)
+			}
+		}
+
+		e.OnDisconnect(ctx, socket, "", nil)
 	}
 }
 
-func (e *Engine) ioPacketHandler(cl *engineio.Socket, enginePacket engineio.Packet) {
-	var packet Packet
-	if err := packet.UnmarshalBinary(enginePacket.Data); err != nil {
-		// TODO: better error handling here
-		return
+// handlerContext returns context for a single handler call.
+func (e *Engine) handlerContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if e.HandlerTimeout > 0 {
+		return context.WithTimeout(parent, e.HandlerTimeout)
 	}
 
-	type packetData [2]json.RawMessage
+	return context.WithCancel(parent)
+}
 
+func (e *Engine) wrapHandler(handler SocketEventHandler) SocketEventHandler {
+	for i := len(e.middlewares) - 1; i >= 0; i-- {
+		handler = e.middlewares[i](handler)
+	}
+
+	return handler
+}
+
+func (e *Engine) ioPacketHandler(cl *engineio.Socket, enginePacket engineio.Packet) {
 	e.mu.RLock()
 	socket := e.engineToSocket[cl]
 	e.mu.RUnlock()
 
+	// Socket was already removed, nothing to handle.
+	if socket == nil {
+		return
+	}
+
+	if err := e.handlePacket(socket, enginePacket.Data); err != nil {
+		e.reportError(socket, err)
+
+		invalid := atomic.AddInt32(&socket.invalidPackets, 1)
+		if max := e.maxInvalidPackets(); max >= 0 && int(invalid) >= max {
+			socket.Close()
+		}
+	}
+}
+
+// handlePacket handles single Socket.IO packet.
+// Returned error means that client sent packet
+// that server is not able to handle.
+func (e *Engine) handlePacket(socket *Socket, rawPacket []byte) error {
+	var packet Packet
+	if err := packet.UnmarshalBinary(rawPacket); err != nil {
+		return err
+	}
+
+	if packet.Namespace != DefaultNamespace {
+		if packet.Type == PacketTypeConnect {
+			e.addToNamespace(socket, packet.Namespace)
+		}
+
+		return fmt.Errorf("%w: %q", ErrUnknownNamespace, packet.Namespace)
+	}
+
+	type packetData [2]json.RawMessage
+
 	switch packet.Type {
 	case PacketTypeConnect:
-		_, err := e.OnConnect(socket, "", packet.Data)
+		socket.Handshake.Auth = append(json.RawMessage(nil), packet.Data...)
+
+		ctx, cancel := e.handlerContext(socket.Context())
+		_, err := e.OnConnect(ctx, socket, "", packet.Data)
+		cancel()
+
 		if err != nil {
 			e.writeToClient(socket, Packet{
 				Type:      PacketTypeConnectError,
 				Namespace: packet.Namespace,
 				Data:      Marshal(ErrorData{Error: err.Error()}),
 			})
+
+			return nil
 		}
 
-		if userID := socket.UserID; userID != "" {
-			e.userIDToSockets[socket.UserID] = append(e.userIDToSockets[socket.UserID], socket)
+		// Each socket is in the room with its own id,
+		// so it is possible to emit to it from any node.
+		rooms := []string{socket.ID}
+		if socket.UserID != "" {
+			rooms = append(rooms, UserRoom(socket.UserID))
+		}
+
+		e.adapter.AddSocket(socket.ID, rooms...)
+
+		if e.Presence != nil && socket.UserID != "" {
+			ctx, cancel := e.handlerContext(socket.Context())
+			if err := e.Presence.connected(ctx, socket.UserID, socket.ID); err != nil {
+				e.reportError(socket, err)
+			}
+			cancel()
 		}
 
-		e.addToNamespace(cl, packet.Namespace)
+		e.addToNamespace(socket, packet.Namespace)
+
+		if e.OfflineStore != nil && socket.UserID != "" {
+			ctx, cancel := e.handlerContext(socket.Context())
+			if err := e.flushOffline(ctx, socket.UserID, func(packet Packet) error {
+				return e.writeToClientContext(ctx, socket, packet)
+			}); err != nil {
+				e.reportError(socket, err)
+			}
+			cancel()
+		}
 	case PacketTypeDisconnect:
-		e.onDisconnect(cl)
+		e.onDisconnect(socket.cl)
 	case PacketTypeEvent:
 		var data packetData
 		if err := e.codec.UnmarshalJSONTo(packet.Data, &data); err != nil {
-			panic(err)
+			return fmt.Errorf("%w: %s", ErrInvalidEvent, err)
 		}
 
-		eventName := string(data[0][1 : len(data[0])-1])
+		var eventName string
+		if err := e.codec.UnmarshalJSONTo(data[0], &eventName); err != nil {
+			return fmt.Errorf("%w: event name: %s", ErrInvalidEvent, err)
+		}
 
 		handler := e.handlers[eventName]
 		if handler == nil {
@@ -275,23 +539,69 @@ func (e *Engine) ioPacketHandler(cl *engineio.Socket, enginePacket engineio.Pack
 		}
 
 		if handler == nil {
-			return
+			return nil
 		}
 
-		resp, err := handler(socket, eventName, data[1])
+		if !e.startHandler() {
+			// Client will retry after it reconnects to other node.
+			if packet.AckID != nil {
+				e.writeToClient(socket, Packet{
+					Type:      PacketTypeAck,
+					Namespace: packet.Namespace,
+					AckID:     packet.AckID,
+					Data:      Marshal([1]any{ErrorData{Error: ErrShuttingDown.Error()}}),
+				})
+			}
 
-		if packet.AckID != nil {
-			packet.Type = PacketTypeAck
+			return nil
+		}
 
-			data := [1]any{resp}
-			if err != nil {
-				data = [1]any{ErrorData{Error: err.Error()}}
-			}
+		socket.dispatcher.dispatch(eventName, func() {
+			defer e.inFlight.Done()
+
+			e.handleEvent(socket, handler, packet, eventName, data[1])
+		})
+	case PacketTypeAck:
+		e.handleAck(socket, packet)
+	case PacketTypeBinaryEvent, PacketTypeBinaryAck:
+		return fmt.Errorf("%w: binary packets are not supported", ErrUnsupportedPacket)
+	default:
+		return fmt.Errorf("%w: client can not send packet of type %q", ErrInvalidPacket, packet.Type)
+	}
+
+	return nil
+}
+
+func (e *Engine) reportError(socket *Socket, err error) {
+	if e.OnError != nil {
+		e.OnError(socket, err)
+	}
+}
+
+func (e *Engine) maxInvalidPackets() int {
+	if e.MaxInvalidPackets == 0 {
+		return DefaultMaxInvalidPackets
+	}
+
+	return e.MaxInvalidPackets
+}
+
+func (e *Engine) handleEvent(socket *Socket, handler SocketEventHandler, packet Packet, eventName string, data []byte) {
+	ctx, cancel := e.handlerContext(socket.Context())
+	resp, err := e.callHandler(ctx, handler, socket, eventName, data)
+	cancel()
 
-			packet.Data = Marshal(data)
+	if packet.AckID != nil {
+		packet.Type = PacketTypeAck
 
-			e.writeToClient(socket, packet)
+		data := [1]any{resp}
+		if err != nil {
+			data = [1]any{ErrorData{Error: err.Error()}}
 		}
+
+		packet.Data = Marshal(data)
+
+		e.writeToClient(socket, packet)
 	}
 }
 
@@ -305,3 +615,16 @@ func (e *Engine) writeToClient(socket *Socket, p Packet) {
 
 	e.ioEngine.Send(socket.cl, ioPacket)
 }
+
+// writeToClientContext writes packet to the client,
+// waiting while its queue is full until ctx is done.
+func (e *Engine) writeToClientContext(ctx context.Context, socket *Socket, p Packet) error {
+	data, _ := p.MarshalBinary()
+
+	ioPacket := engineio.Packet{
+		Type: engineio.PacketTypeMessage,
+		Data: data,
+	}
+
+	return e.ioEngine.SendContext(ctx, socket.cl, ioPacket)
+}
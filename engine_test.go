@@ -4,7 +4,15 @@ import (
 	"context"
 	"io"
 	"net"
+	"strings"
+	"sync"
+	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func write(writer io.Writer, bytes []byte) error {
@@ -14,12 +22,12 @@ func write(writer io.Writer, bytes []byte) error {
 
 func read(rw io.ReadWriter) ([]byte, error) {
 	bts := make([]byte, 1024)
-	_, err := rw.Read(bts)
+	n, err := rw.Read(bts)
 	if err != nil {
 		return nil, err
 	}
 
-	return bts, nil
+	return bts[:n], nil
 }
 
 var _ net.Conn = &Conn{}
@@ -30,6 +38,10 @@ type Conn struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// mu guards send channel from being written to after close.
+	mu        sync.Mutex
+	closeOnce sync.Once
 }
 
 func NewConn() *Conn {
@@ -60,19 +72,31 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 }
 
 func (c *Conn) Write(b []byte) (n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.ctx.Err() != nil {
 		return 0, c.ctx.Err()
 	}
 
-	c.send <- b
+	select {
+	case c.send <- b:
+	case <-c.ctx.Done():
+		return 0, c.ctx.Err()
+	}
 
 	return len(b), nil
 }
 
 func (c *Conn) Close() error {
-	c.cancel()
-	close(c.send)
-	close(c.receive)
+	c.closeOnce.Do(func() {
+		c.cancel()
+
+		c.mu.Lock()
+		close(c.send)
+		close(c.receive)
+		c.mu.Unlock()
+	})
 
 	return nil
 }
@@ -83,21 +107,263 @@ func (c *Conn) LocalAddr() net.Addr {
 }
 
 func (c *Conn) RemoteAddr() net.Addr {
-	// TODO implement me
-	panic("implement me")
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
 }
 
 func (c *Conn) SetDeadline(t time.Time) error {
-	// TODO implement me
-	panic("implement me")
+	return nil
 }
 
 func (c *Conn) SetReadDeadline(t time.Time) error {
-	// TODO implement me
-	panic("implement me")
+	return nil
 }
 
 func (c *Conn) SetWriteDeadline(t time.Time) error {
-	// TODO implement me
-	panic("implement me")
+	return nil
+}
+
+// ClientSend sends data to the server as if client wrote it.
+func (c *Conn) ClientSend(data string) {
+	c.receive <- func() []byte { return []byte(data) }
+}
+
+// ClientRead returns next message that server wrote to the client.
+func (c *Conn) ClientRead(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case bts := <-c.send:
+		return string(bts)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message from server")
+		return ""
+	}
+}
+
+func newTestEngine() *Engine {
+	return NewEngine(nil, time.Minute, time.Second, read, write, nil, nil)
+}
+
+// connectClient adds new client to the engine and
+// connects it to the default namespace.
+func connectClient(t *testing.T, e *Engine) *Conn {
+	t.Helper()
+
+	conn := NewConn()
+	e.AddClient(conn)
+
+	require.True(t, strings.HasPrefix(conn.ClientRead(t), "0{"), "expected open packet")
+
+	conn.ClientSend("40")
+	require.True(t, strings.HasPrefix(conn.ClientRead(t), "40{"), "expected connect packet")
+
+	return conn
+}
+
+func TestEngine_InvalidPackets(t *testing.T) {
+	errs := make(chan error, 4)
+
+	e := newTestEngine()
+	e.MaxInvalidPackets = 3
+	e.OnError = func(_ *Socket, err error) {
+		errs <- err
+	}
+
+	conn := connectClient(t, e)
+
+	conn.ClientSend(`4x`)
+	require.ErrorIs(t, <-errs, ErrInvalidPacket)
+
+	conn.ClientSend(`42"hello"`)
+	require.ErrorIs(t, <-errs, ErrInvalidEvent)
+
+	conn.ClientSend(`42/chat,["hello"]`)
+	require.ErrorIs(t, <-errs, ErrUnknownNamespace)
+
+	// Client is disconnected after reaching the limit.
+	require.Equal(t, "1", conn.ClientRead(t))
+}
+
+func TestEngine_Presence(t *testing.T) {
+	ctx := context.Background()
+
+	e := newTestEngine()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+
+	// Without presence users are found through the adapter.
+	alice := connectUser(t, e, "alice")
+
+	online, err := e.IsOnline(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, online)
+
+	users, err := e.OnlineUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, users)
+
+	alice.ClientSend("41")
+	require.Eventually(t, func() bool {
+		online, err := e.IsOnline(ctx, "alice")
+		return err == nil && !online
+	}, time.Second, 5*time.Millisecond)
+
+	events := make(chan string, 4)
+
+	e = newTestEngine()
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+	e.Presence = NewPresence(e, NewMemoryPresenceStore())
+	e.Presence.OnOnline = func(_ context.Context, userID string) {
+		events <- "online " + userID
+	}
+	e.Presence.OnOffline = func(_ context.Context, userID string) {
+		events <- "offline " + userID
+	}
+
+	first := connectUser(t, e, "bob")
+	second := connectUser(t, e, "bob")
+	assert.Equal(t, "online bob", <-events)
+
+	online, err = e.IsOnline(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, online)
+
+	first.ClientSend("41")
+	second.ClientSend("41")
+	assert.Equal(t, "offline bob", <-events)
+	assert.Empty(t, events)
+
+	users, err = e.OnlineUsers(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestPresence_Cluster(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	store := NewMemoryPresenceStore()
+
+	events := make(chan string, 8)
+
+	newEngine := func(name string) *Engine {
+		r := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		t.Cleanup(func() { _ = r.Close() })
+
+		a := NewRedisAdapter(nil, r, "")
+		a.HeartbeatInterval = 20 * time.Millisecond
+
+		e := NewEngine(nil, time.Minute, time.Second, read, write, nil, a)
+		e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+			s.UserID = string(data)
+			return nil, nil
+		}
+		e.Presence = NewPresence(e, store)
+		e.Presence.OnOnline = func(_ context.Context, userID string) {
+			events <- name + ": online " + userID
+		}
+		e.Presence.OnOffline = func(_ context.Context, userID string) {
+			events <- name + ": offline " + userID
+		}
+
+		require.NoError(t, a.Start(ctx))
+		t.Cleanup(func() { _ = a.Close() })
+
+		return e
+	}
+
+	a, b := newEngine("a"), newEngine("b")
+	require.Eventually(t, func() bool {
+		return len(a.Nodes()) == 2 && len(b.Nodes()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// Handlers are called on every node.
+	conn := connectUser(t, b, "alice")
+	assert.ElementsMatch(t, []string{"a: online alice", "b: online alice"}, []string{<-events, <-events})
+
+	conn.ClientSend("41")
+	assert.ElementsMatch(t, []string{"a: offline alice", "b: offline alice"}, []string{<-events, <-events})
+
+	// Users of node that is not live go offline.
+	_, err := store.Connect(ctx, "dead", "bob", "s1")
+	require.NoError(t, err)
+
+	a.Presence.CheckInterval = 10 * time.Millisecond
+	a.Presence.NodeTimeout = 50 * time.Millisecond
+	require.NoError(t, a.Presence.Start(ctx))
+	t.Cleanup(func() { _ = a.Presence.Close() })
+
+	assert.ElementsMatch(t, []string{"a: offline bob", "b: offline bob"}, []string{<-events, <-events})
+
+	online, err := b.IsOnline(ctx, "bob")
+	require.NoError(t, err)
+	assert.False(t, online)
+}
+
+// healthAdapter is memory adapter that reports its health.
+type healthAdapter struct {
+	*MemoryAdapter
+	healthy bool
+}
+
+func (a *healthAdapter) Healthy() bool {
+	return a.healthy
+}
+
+func TestPresence_Check(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryPresenceStore()
+	adapter := &healthAdapter{MemoryAdapter: NewMemoryAdapter()}
+
+	e := NewEngine(nil, time.Minute, time.Second, read, write, nil, adapter)
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+	e.Presence = NewPresence(e, store)
+	e.Presence.NodeTimeout = time.Minute
+	e.Presence.missing = make(map[string]time.Time)
+
+	connectUser(t, e, "alice")
+
+	_, err := store.Connect(ctx, "other", "bob", "s1")
+	require.NoError(t, err)
+
+	// Nodes are not removed while adapter is not healthy.
+	now := time.Now()
+	require.NoError(t, e.Presence.check(ctx, now))
+	require.NoError(t, e.Presence.check(ctx, now.Add(2*time.Minute)))
+
+	online, err := e.IsOnline(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, online)
+
+	// Timeout starts again when adapter is healthy.
+	adapter.healthy = true
+	require.NoError(t, e.Presence.check(ctx, now.Add(3*time.Minute)))
+
+	online, err = e.IsOnline(ctx, "bob")
+	require.NoError(t, err)
+	assert.True(t, online)
+
+	require.NoError(t, e.Presence.check(ctx, now.Add(5*time.Minute)))
+
+	online, err = e.IsOnline(ctx, "bob")
+	require.NoError(t, err)
+	assert.False(t, online)
+
+	// Sockets of this node are added back after they were removed.
+	offline, err := store.RemoveNode(ctx, e.uid())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, offline)
+
+	require.NoError(t, e.Presence.check(ctx, now.Add(6*time.Minute)))
+
+	online, err = e.IsOnline(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, online)
 }
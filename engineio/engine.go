@@ -1,6 +1,7 @@
 package engineio
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -44,7 +45,9 @@ type Engine struct {
 
 	metrics *Metrics
 
-	mu sync.RWMutex
+	mu      sync.RWMutex
+	clients map[*Socket]struct{}
+	closed  bool
 }
 
 func NewEngine(reg prometheus.Registerer, pingInterval, pingTimeout time.Duration, read ReadBytes, write WriteBytes, packetHandler PacketHandler) *Engine {
@@ -58,22 +61,32 @@ func NewEngine(reg prometheus.Registerer, pingInterval, pingTimeout time.Duratio
 		PacketHandler: packetHandler,
 
 		metrics: NewMetrics(reg),
+		clients: make(map[*Socket]struct{}),
 	}
 }
 
 // NewClient creates and inserts socket to the engine.
+// If engine is shut down - connection is closed and nil is returned.
 //
 // TODO: split this to NewClient(net.Conn) and AddClient(*Socket)
 func (e *Engine) NewClient(conn net.Conn) *Socket {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	if e.closed {
+		_ = conn.Close()
+		return nil
+	}
+
 	cl := &Socket{
 		engine: e,
 		conn:   conn,
 		send:   make(chan Packet, 16),
+		done:   make(chan struct{}),
 	}
 
+	e.clients[cl] = struct{}{}
+
 	e.metrics.CurrentClients.Inc()
 
 	// FIXME: Refactor this to a separate method that will start running only after initial handshake.
@@ -85,6 +98,47 @@ func (e *Engine) NewClient(conn net.Conn) *Socket {
 	return cl
 }
 
+// Shutdown stops accepting new clients and closes existing ones.
+// Each client receives close packet after packets already queued for it.
+//
+// It waits until all queues are sent or ctx is done. In the latter
+// case remaining connections are closed right away and ctx error is returned.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	e.closed = true
+
+	clients := make([]*Socket, 0, len(e.clients))
+	for cl := range e.clients {
+		clients = append(clients, cl)
+	}
+	e.mu.Unlock()
+
+	for _, cl := range clients {
+		_ = cl.Close()
+	}
+
+	for _, cl := range clients {
+		select {
+		case <-cl.done:
+		case <-ctx.Done():
+			for _, cl := range clients {
+				_ = cl.conn.Close()
+			}
+
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) removeClient(cl *Socket) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.clients, cl)
+}
+
 func (e *Engine) readPacket(conn net.Conn) (Packet, error) {
 	data, err := e.Read(conn)
 	if err != nil {
@@ -103,6 +157,10 @@ func (e *Engine) Send(cl *Socket, packet Packet) {
 	cl.Write(packet)
 }
 
+func (e *Engine) SendContext(ctx context.Context, cl *Socket, packet Packet) error {
+	return cl.WriteContext(ctx, packet)
+}
+
 func (e *Engine) sendOpenPacket(cl *Socket) {
 	p := OpenPacket{
 		SID:          SocketID,
@@ -3,8 +3,12 @@ package engineio
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 )
 
+// ErrInvalidPacket is returned when packet can not be parsed.
+var ErrInvalidPacket = errors.New("invalid Engine.IO packet")
+
 var probeBts = []byte("probe")
 
 var pingPacketBts = func() []byte {
@@ -59,7 +63,10 @@ func (p *Packets) UnmarshalBinary(data []byte) error {
 	*p = make(Packets, 0, len(bytesPckt))
 	for _, bts := range bytesPckt {
 		pckt := Packet{}
-		pckt.UnmarshalBinary(bts)
+		if err := pckt.UnmarshalBinary(bts); err != nil {
+			return err
+		}
+
 		*p = append(*p, pckt)
 	}
 
@@ -75,6 +82,10 @@ func (p Packet) MarshalBinary() (data []byte, err error) {
 }
 
 func (p *Packet) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return ErrInvalidPacket
+	}
+
 	p.Type = PacketType(data[0])
 	p.Data = data[1:]
 
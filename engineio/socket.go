@@ -1,8 +1,10 @@
 package engineio
 
 import (
+	"context"
+	"errors"
 	"net"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
@@ -11,31 +13,76 @@ import (
 // It is not used on reconnections, neither to deferentiate socket clients.
 const SocketID = "9Cx9Ds4C"
 
+// ErrSocketClosed is returned when packet is written to closed socket.
+var ErrSocketClosed = errors.New("socket is closed")
+
 type Socket struct {
 	engine *Engine
 	conn   net.Conn
 
 	send chan Packet
+	// done is closed when all queued packets are sent
+	// or connection is broken.
+	done chan struct{}
 
-	closed int32
+	// mu guards send channel from being written to after close.
+	mu     sync.RWMutex
+	closed bool
 }
 
+// Write queues packet to be sent to the client.
+// Packet is dropped if socket is closed or queue is full.
 func (c *Socket) Write(p Packet) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return
+	}
+
 	select {
 	case c.send <- p:
 	default:
 	}
 }
 
+// WriteContext queues packet to be sent to the client.
+// Unlike `Write` it waits while queue is full, until ctx is done.
+// `ErrSocketClosed` is returned if socket is closed meanwhile.
+func (c *Socket) WriteContext(ctx context.Context, p Packet) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrSocketClosed
+	}
+
+	// Queue is not drained after write routine exits,
+	// and socket can not be closed while this waits.
+	select {
+	case c.send <- p:
+		return nil
+	case <-c.done:
+		return ErrSocketClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *Socket) Close() error {
 	// Close only once.
 	// Unfortunately this is a ad-hoc temporary solution.
 	// FIXME: implement non-recursive way of closing connection.
-	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
 		return nil
 	}
 
+	c.closed = true
 	close(c.send)
+	c.mu.Unlock()
+	c.engine.removeClient(c)
 	c.engine.metrics.CurrentClients.Dec()
 
 	c.engine.OnDisconnect(c)
@@ -74,6 +121,7 @@ func (c *Socket) writeRoutine(pingInterval time.Duration) {
 		ticker.Stop()
 
 		_ = c.conn.Close()
+		close(c.done)
 	}()
 
 	for {
@@ -8,6 +8,19 @@ type Metrics struct {
 	TotalSockets prometheus.Gauge
 
 	EmitForUserCalls prometheus.Counter
+
+	HandlerQueueDepth prometheus.Gauge
+	HandlersInFlight  prometheus.Gauge
+	HandlerPanics     prometheus.Counter
+
+	OfflineQueued  prometheus.Counter
+	OfflineFlushed prometheus.Counter
+
+	ReliablePending  prometheus.Gauge
+	ReliableRetries  prometheus.Counter
+	ReliableFinished *prometheus.CounterVec
+
+	Rebalanced prometheus.Counter
 }
 
 func NewMetrics(reg prometheus.Registerer) *Metrics {
@@ -24,12 +37,148 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 			Name:      "emits_total",
 			Help:      "Number of calls to EmitForUser.",
 		}),
+		HandlerQueueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "handler_queue_depth",
+			Help:      "Number of received events waiting for handler to start.",
+		}),
+		HandlersInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "handlers_in_flight",
+			Help:      "Number of event handlers currently running.",
+		}),
+		HandlerPanics: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "handler_panics_total",
+			Help:      "Number of recovered panics in event handlers.",
+		}),
+		OfflineQueued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "offline_queued_total",
+			Help:      "Number of events queued for offline users.",
+		}),
+		OfflineFlushed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "offline_flushed_total",
+			Help:      "Number of queued events sent to users after they connected.",
+		}),
+		ReliablePending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "reliable_pending",
+			Help:      "Number of reliable messages waiting for acknowledgement.",
+		}),
+		ReliableRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "reliable_retries_total",
+			Help:      "Number of times reliable messages were resent.",
+		}),
+		ReliableFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "reliable_finished_total",
+			Help:      "Number of reliable messages by their final delivery status.",
+		}, []string{"status"}),
+		Rebalanced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "pleasetalk",
+			Subsystem: "socketio",
+			Name:      "rebalanced_total",
+			Help:      "Number of sockets disconnected to rebalance them across nodes.",
+		}),
 	}
 
 	if reg != nil {
 		reg.MustRegister(
 			m.TotalSockets,
 			m.EmitForUserCalls,
+			m.HandlerQueueDepth,
+			m.HandlersInFlight,
+			m.HandlerPanics,
+			m.OfflineQueued,
+			m.OfflineFlushed,
+			m.ReliablePending,
+			m.ReliableRetries,
+			m.ReliableFinished,
+			m.Rebalanced,
+		)
+	}
+
+	return m
+}
+
+// AdapterMetrics are metrics of adapters that
+// deliver packets to other nodes.
+type AdapterMetrics struct {
+	Published prometheus.Counter
+	Received  prometheus.Counter
+	Malformed prometheus.Counter
+	Healthy   prometheus.Gauge
+	Nodes     prometheus.Gauge
+	Routed    prometheus.Counter
+}
+
+func NewAdapterMetrics(reg prometheus.Registerer, adapter string) *AdapterMetrics {
+	labels := prometheus.Labels{"adapter": adapter}
+
+	m := &AdapterMetrics{
+		Published: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "published_total",
+			Help:        "Number of messages published to other nodes.",
+			ConstLabels: labels,
+		}),
+		Received: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "received_total",
+			Help:        "Number of messages received from other nodes.",
+			ConstLabels: labels,
+		}),
+		Malformed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "malformed_total",
+			Help:        "Number of received messages that could not be decoded.",
+			ConstLabels: labels,
+		}),
+		Healthy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "healthy",
+			Help:        "Whether adapter is connected and receives messages from other nodes.",
+			ConstLabels: labels,
+		}),
+		Nodes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "nodes",
+			Help:        "Number of live nodes in the cluster, including this one.",
+			ConstLabels: labels,
+		}),
+		Routed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "pleasetalk",
+			Subsystem:   "socketio_adapter",
+			Name:        "routed_total",
+			Help:        "Number of broadcasts published only to nodes that have sockets of their users.",
+			ConstLabels: labels,
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(
+			m.Published,
+			m.Received,
+			m.Malformed,
+			m.Healthy,
+			m.Nodes,
+			m.Routed,
 		)
 	}
 
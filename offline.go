@@ -0,0 +1,130 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultOfflineTTL is used if TTL of offline store is not set.
+	DefaultOfflineTTL = 24 * time.Hour
+	// DefaultOfflineMaxLen is used if MaxLen of offline store is not set.
+	DefaultOfflineMaxLen = 100
+)
+
+// OfflineStore keeps events for users that had no sockets
+// when events were emitted. Store is shared by all nodes.
+//
+// Messages older than store's TTL are not returned, and only
+// MaxLen newest messages of each user are kept.
+type OfflineStore interface {
+	// Push appends message to the queue of the user.
+	Push(ctx context.Context, userID string, msg OfflineMessage) error
+	// Take removes all messages of the user and returns
+	// those that did not expire, oldest first.
+	Take(ctx context.Context, userID string) ([]OfflineMessage, error)
+}
+
+// OfflineMessage is event queued for offline user.
+type OfflineMessage struct {
+	// Data is data of event packet: event name and its data.
+	Data json.RawMessage `json:"data"`
+	// Time is when event was queued.
+	Time time.Time `json:"time"`
+}
+
+// EmitForUserOrQueue emits event to all sockets of the user,
+// or stores it in `OfflineStore` if user has no sockets on any node.
+// Queued events are sent to the next socket of the user that connects.
+//
+// Whether user is online is checked with `IsOnline`, and checked again
+// after event is queued. Without `Presence` each check fetches sockets
+// of the user from all nodes, so each call makes up to two requests to
+// all nodes. `Presence` should be set if events are emitted often.
+//
+// If `OfflineStore` is not set, it behaves as `EmitForUser`.
+func (e *Engine) EmitForUserOrQueue(ctx context.Context, userID, event string, data any) error {
+	if e.OfflineStore == nil {
+		return e.EmitForUser(ctx, userID, event, data)
+	}
+
+	online, err := e.IsOnline(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("check if user is online: %w", err)
+	}
+
+	if online {
+		return e.EmitForUser(ctx, userID, event, data)
+	}
+
+	packet, err := e.eventPacket(event, data)
+	if err != nil {
+		return err
+	}
+
+	if err := e.OfflineStore.Push(ctx, userID, OfflineMessage{Data: packet.Data, Time: time.Now()}); err != nil {
+		return fmt.Errorf("queue event: %w", err)
+	}
+
+	e.metrics.OfflineQueued.Inc()
+
+	// User could connect after it was checked, but before event was queued,
+	// so queue would not be flushed until the next connection.
+	if online, err := e.IsOnline(ctx, userID); err != nil || !online {
+		return nil
+	}
+
+	return e.flushOffline(ctx, userID, func(packet Packet) error {
+		return e.adapter.Broadcast(ctx, packet, BroadcastOptions{Rooms: []string{UserRoom(userID)}})
+	})
+}
+
+// flushOffline takes queued events of the user and sends them in order.
+// Events that were not sent are queued again, after
+// events that were queued while these were sent.
+func (e *Engine) flushOffline(ctx context.Context, userID string, send func(packet Packet) error) error {
+	msgs, err := e.OfflineStore.Take(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("take queued events: %w", err)
+	}
+
+	for i, msg := range msgs {
+		if err := send(Packet{
+			Type:      PacketTypeEvent,
+			Namespace: DefaultNamespace,
+			Data:      msg.Data,
+		}); err != nil {
+			err = fmt.Errorf("send queued event: %w", err)
+
+			for _, msg := range msgs[i:] {
+				if pushErr := e.OfflineStore.Push(ctx, userID, msg); pushErr != nil {
+					return fmt.Errorf("%w, queue it again: %s", err, pushErr)
+				}
+			}
+
+			return err
+		}
+
+		e.metrics.OfflineFlushed.Inc()
+	}
+
+	return nil
+}
+
+func offlineTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return DefaultOfflineTTL
+	}
+
+	return ttl
+}
+
+func offlineMaxLen(maxLen int) int {
+	if maxLen <= 0 {
+		return DefaultOfflineMaxLen
+	}
+
+	return maxLen
+}
@@ -0,0 +1,66 @@
+package socketio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ OfflineStore = &MemoryOfflineStore{}
+
+// MemoryOfflineStore keeps queued events in memory.
+// It can be shared only by engines in the same process,
+// so it is suitable for single node and tests.
+type MemoryOfflineStore struct {
+	// TTL is how long events are kept.
+	// If not set `DefaultOfflineTTL` is used.
+	TTL time.Duration
+	// MaxLen is maximum number of events kept for a user.
+	// If not set `DefaultOfflineMaxLen` is used.
+	MaxLen int
+
+	mu    sync.Mutex
+	users map[string][]OfflineMessage
+}
+
+func NewMemoryOfflineStore() *MemoryOfflineStore {
+	return &MemoryOfflineStore{
+		users: make(map[string][]OfflineMessage),
+	}
+}
+
+func (s *MemoryOfflineStore) Push(_ context.Context, userID string, msg OfflineMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := append(s.unexpiredUnsafe(userID), msg)
+	if maxLen := offlineMaxLen(s.MaxLen); len(msgs) > maxLen {
+		msgs = append([]OfflineMessage(nil), msgs[len(msgs)-maxLen:]...)
+	}
+
+	s.users[userID] = msgs
+
+	return nil
+}
+
+func (s *MemoryOfflineStore) Take(_ context.Context, userID string) ([]OfflineMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := s.unexpiredUnsafe(userID)
+	delete(s.users, userID)
+
+	return msgs, nil
+}
+
+// unexpiredUnsafe returns messages of the user that did not expire.
+func (s *MemoryOfflineStore) unexpiredUnsafe(userID string) []OfflineMessage {
+	deadline := time.Now().Add(-offlineTTL(s.TTL))
+
+	msgs := s.users[userID]
+	for len(msgs) != 0 && !msgs[0].Time.After(deadline) {
+		msgs = msgs[1:]
+	}
+
+	return msgs
+}
@@ -0,0 +1,101 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ OfflineStore = &RedisOfflineStore{}
+
+var (
+	// KEYS: user. ARGV: message, max length, ttl in milliseconds.
+	offlinePushScript = redis.NewScript(`
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('LTRIM', KEYS[1], -tonumber(ARGV[2]), -1)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+
+return 0
+`)
+
+	// KEYS: user.
+	offlineTakeScript = redis.NewScript(`
+local msgs = redis.call('LRANGE', KEYS[1], 0, -1)
+redis.call('DEL', KEYS[1])
+
+return msgs
+`)
+)
+
+// RedisOfflineStore keeps queued events in Redis lists,
+// so they can be shared by all nodes.
+//
+// List of the user expires after TTL since the last event was queued.
+// Expiration of single events is based on clocks of nodes,
+// so they should be synchronized.
+type RedisOfflineStore struct {
+	r      redis.UniversalClient
+	prefix string
+
+	// TTL is how long events are kept.
+	// If not set `DefaultOfflineTTL` is used.
+	TTL time.Duration
+	// MaxLen is maximum number of events kept for a user.
+	// If not set `DefaultOfflineMaxLen` is used.
+	MaxLen int
+}
+
+// NewRedisOfflineStore creates store with keys that start with "prefix:".
+// If prefix is empty - "offline" is used.
+func NewRedisOfflineStore(r redis.UniversalClient, prefix string) *RedisOfflineStore {
+	if prefix == "" {
+		prefix = "offline"
+	}
+
+	return &RedisOfflineStore{
+		r:      r,
+		prefix: prefix + ":",
+	}
+}
+
+func (s *RedisOfflineStore) Push(ctx context.Context, userID string, msg OfflineMessage) error {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return offlinePushScript.Run(ctx, s.r,
+		[]string{s.userKey(userID)},
+		bts, offlineMaxLen(s.MaxLen), offlineTTL(s.TTL).Milliseconds(),
+	).Err()
+}
+
+func (s *RedisOfflineStore) Take(ctx context.Context, userID string) ([]OfflineMessage, error) {
+	raw, err := offlineTakeScript.Run(ctx, s.r, []string{s.userKey(userID)}).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(-offlineTTL(s.TTL))
+
+	msgs := make([]OfflineMessage, 0, len(raw))
+	for _, r := range raw {
+		var msg OfflineMessage
+		if err := json.Unmarshal([]byte(r), &msg); err != nil {
+			return msgs, fmt.Errorf("decode queued event: %w", err)
+		}
+
+		if msg.Time.After(deadline) {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	return msgs, nil
+}
+
+func (s *RedisOfflineStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
@@ -0,0 +1,144 @@
+package socketio
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var _ OfflineStore = &SQLOfflineStore{}
+
+// DefaultOfflineTable is used if table is not provided to `NewSQLOfflineStore`.
+const DefaultOfflineTable = "socketio_offline"
+
+// SQLOfflineStore keeps queued events in SQL table, so they
+// can be shared by all nodes. Queries use "$1" placeholders and
+// DELETE ... RETURNING, which are supported by PostgreSQL and SQLite.
+//
+// Table is created with `CreateTable`. Events of users that never
+// connect again are deleted with `DeleteExpired`.
+type SQLOfflineStore struct {
+	db    *sql.DB
+	table string
+
+	// TTL is how long events are kept.
+	// If not set `DefaultOfflineTTL` is used.
+	TTL time.Duration
+	// MaxLen is maximum number of events kept for a user.
+	// If not set `DefaultOfflineMaxLen` is used.
+	MaxLen int
+}
+
+// NewSQLOfflineStore creates store that keeps events in the table.
+// Table name is not quoted, so it must be a valid identifier.
+func NewSQLOfflineStore(db *sql.DB, table string) *SQLOfflineStore {
+	if table == "" {
+		table = DefaultOfflineTable
+	}
+
+	return &SQLOfflineStore{
+		db:    db,
+		table: table,
+	}
+}
+
+// CreateTable creates table for events, if it does not exist.
+func (s *SQLOfflineStore) CreateTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+		user_id    VARCHAR(255) NOT NULL,
+		created_at BIGINT NOT NULL,
+		data       TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create offline table: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx,
+		`CREATE INDEX IF NOT EXISTS `+s.table+`_user_idx ON `+s.table+` (user_id, created_at)`,
+	); err != nil {
+		return fmt.Errorf("create offline index: %w", err)
+	}
+
+	return nil
+}
+
+// Push inserts message and deletes expired and
+// oldest messages of the user over the limit.
+func (s *SQLOfflineStore) Push(ctx context.Context, userID string, msg OfflineMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO `+s.table+` (user_id, created_at, data) VALUES ($1, $2, $3)`,
+		userID, msg.Time.UnixNano(), string(msg.Data),
+	); err != nil {
+		return fmt.Errorf("insert event: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM `+s.table+` WHERE user_id = $1 AND (created_at <= $2 OR created_at < (
+			SELECT created_at FROM `+s.table+` WHERE user_id = $1
+			ORDER BY created_at DESC LIMIT 1 OFFSET $3
+		))`,
+		userID, s.deadline(), offlineMaxLen(s.MaxLen)-1,
+	); err != nil {
+		return fmt.Errorf("trim events: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLOfflineStore) Take(ctx context.Context, userID string) ([]OfflineMessage, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`DELETE FROM `+s.table+` WHERE user_id = $1 RETURNING created_at, data`, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadline := s.deadline()
+
+	var msgs []OfflineMessage
+	for rows.Next() {
+		var (
+			createdAt int64
+			data      string
+		)
+
+		if err := rows.Scan(&createdAt, &data); err != nil {
+			return nil, err
+		}
+
+		if createdAt > deadline {
+			msgs = append(msgs, OfflineMessage{Data: []byte(data), Time: time.Unix(0, createdAt)})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Deleted rows are returned in no particular order.
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Time.Before(msgs[j].Time)
+	})
+
+	return msgs, nil
+}
+
+// DeleteExpired deletes expired events of all users.
+func (s *SQLOfflineStore) DeleteExpired(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM `+s.table+` WHERE created_at <= $1`, s.deadline())
+
+	return err
+}
+
+// deadline returns time in nanoseconds at or before which events are expired.
+func (s *SQLOfflineStore) deadline() int64 {
+	return time.Now().Add(-offlineTTL(s.TTL)).UnixNano()
+}
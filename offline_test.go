@@ -0,0 +1,108 @@
+package socketio_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+)
+
+func TestOfflineStores(t *testing.T) {
+	const (
+		ttl    = 100 * time.Millisecond
+		maxLen = 3
+	)
+
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T) socketio.OfflineStore
+	}{
+		{
+			name: "Memory",
+			newStore: func(t *testing.T) socketio.OfflineStore {
+				s := socketio.NewMemoryOfflineStore()
+				s.TTL = ttl
+				s.MaxLen = maxLen
+
+				return s
+			},
+		},
+		{
+			name: "Redis",
+			newStore: func(t *testing.T) socketio.OfflineStore {
+				s := socketio.NewRedisOfflineStore(newRedisClient(t, miniredis.RunT(t)), "")
+				s.TTL = ttl
+				s.MaxLen = maxLen
+
+				return s
+			},
+		},
+		{
+			name: "SQL",
+			newStore: func(t *testing.T) socketio.OfflineStore {
+				db, err := sql.Open("pgx", postgresURL(t))
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = db.Close() })
+
+				s := socketio.NewSQLOfflineStore(db, uniqueName("offline"))
+				s.TTL = ttl
+				s.MaxLen = maxLen
+				require.NoError(t, s.CreateTable(context.Background()))
+
+				return s
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := test.newStore(t)
+
+			push := func(userID string, n int) {
+				require.NoError(t, s.Push(ctx, userID, socketio.OfflineMessage{
+					Data: json.RawMessage(`["event",` + strconv.Itoa(n) + `]`),
+					Time: time.Now(),
+				}))
+			}
+
+			take := func(userID string) []string {
+				msgs, err := s.Take(ctx, userID)
+				require.NoError(t, err)
+
+				data := make([]string, len(msgs))
+				for i, msg := range msgs {
+					data[i] = string(msg.Data)
+				}
+
+				return data
+			}
+
+			for i := 1; i <= 5; i++ {
+				push("alice", i)
+			}
+			push("bob", 1)
+
+			// Only newest messages are kept.
+			assert.Equal(t, []string{`["event",3]`, `["event",4]`, `["event",5]`}, take("alice"))
+			assert.Empty(t, take("alice"))
+
+			push("alice", 6)
+			time.Sleep(ttl)
+			push("alice", 7)
+
+			assert.Equal(t, []string{`["event",7]`}, take("alice"))
+			assert.Empty(t, take("bob"))
+		})
+	}
+}
@@ -3,6 +3,8 @@ package socketio
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 )
 
@@ -32,6 +34,21 @@ type ErrorData struct {
 	Error string `json:"error"`
 }
 
+var (
+	// ErrInvalidPacket is returned when received packet can not be parsed
+	// or has packet type that client is not allowed to send.
+	ErrInvalidPacket = errors.New("invalid packet")
+	// ErrUnsupportedPacket is returned for valid packets
+	// that are not supported by this implementation, like binary events.
+	ErrUnsupportedPacket = errors.New("unsupported packet")
+	// ErrUnknownNamespace is returned when packet is sent to namespace
+	// that is not served by the engine.
+	ErrUnknownNamespace = errors.New("unknown namespace")
+	// ErrInvalidEvent is returned when event packet data is not an array
+	// with event name as its first element.
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
 func (p Packet) MarshalBinary() (data []byte, err error) {
 	var b bytes.Buffer
 
@@ -56,6 +73,14 @@ func UnmarshalPacket(data []byte) (p Packet, err error) {
 }
 
 func (p *Packet) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty packet", ErrInvalidPacket)
+	}
+
+	if data[0] < PacketTypeConnect[0] || data[0] > PacketTypeBinaryAck[0] {
+		return fmt.Errorf("%w: unknown packet type %q", ErrInvalidPacket, data[0])
+	}
+
 	p.Type = PacketType(data[0])
 	data = data[1:]
 	p.Namespace = "/"
@@ -63,13 +88,25 @@ func (p *Packet) UnmarshalBinary(data []byte) error {
 		return nil
 	}
 
-	if len(data) != 0 && data[0] == '/' {
+	if data[0] == '/' {
+		// Namespace can be the last part of the packet,
+		// in which case it is not followed by separator.
 		idx := bytes.IndexByte(data, ',')
+		if idx == -1 {
+			p.Namespace = string(data)
+			return nil
+		}
+
 		p.Namespace = string(data[:idx])
 		data = data[idx+1:]
 	}
 
-	if ack, idx := readInt(data); ack != nil {
+	ack, idx, err := readInt(data)
+	if err != nil {
+		return fmt.Errorf("%w: ack id: %s", ErrInvalidPacket, err)
+	}
+
+	if ack != nil {
 		p.AckID = ack
 		data = data[idx:]
 	}
@@ -81,22 +118,22 @@ func (p *Packet) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-func readInt(data []byte) (*int, int) {
-	if len(data) == 0 {
-		return nil, 0
-	}
-
+func readInt(data []byte) (*int, int, error) {
 	var ptr int
-	for data[ptr] >= '0' && data[ptr] <= '9' {
+	for ptr < len(data) && data[ptr] >= '0' && data[ptr] <= '9' {
 		ptr++
 	}
 
 	if ptr == 0 {
-		return nil, 0
+		return nil, 0, nil
+	}
+
+	val, err := strconv.Atoi(string(data[:ptr]))
+	if err != nil {
+		return nil, 0, err
 	}
 
-	val, _ := strconv.Atoi(string(data[:ptr]))
-	return &val, ptr
+	return &val, ptr, nil
 }
 
 func Marshal(val any) []byte {
@@ -77,6 +77,32 @@ func TestPacket_UnmarshalBinary(t *testing.T) {
 	}
 }
 
+func TestPacket_UnmarshalBinary_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: []byte("")},
+		{name: "Unknown type", data: []byte("9")},
+		{name: "Non-numeric type", data: []byte(`["hello"]`)},
+		{name: "Ack id overflow", data: []byte(`2/a,99999999999999999999999["hello"]`)},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			_, err := UnmarshalPacket(test.data)
+			assert.ErrorIs(t, err, ErrInvalidPacket)
+		})
+	}
+}
+
+func TestPacket_UnmarshalBinary_NamespaceWithoutSeparator(t *testing.T) {
+	p, err := UnmarshalPacket([]byte("0/admin"))
+	assert.NoError(t, err)
+	assert.Equal(t, Packet{Type: PacketTypeConnect, Namespace: "/admin"}, p)
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
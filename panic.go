@@ -0,0 +1,73 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// errInternal is sent to the client as ack error
+// if handler panicked. Panic value itself is not exposed.
+var errInternal = errors.New("internal server error")
+
+// PanicError is reported to `Engine.OnError` when
+// event handler panics.
+type PanicError struct {
+	Event string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %q handler: %v", e.Event, e.Value)
+}
+
+// callHandler calls handler wrapped with middlewares and
+// recovers from panic in it, if any.
+func (e *Engine) callHandler(ctx context.Context, handler SocketEventHandler, socket *Socket, event string, data []byte) (resp any, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		e.metrics.HandlerPanics.Inc()
+		e.reportError(socket, &PanicError{
+			Event: event,
+			Value: v,
+			Stack: debug.Stack(),
+		})
+
+		if e.DisconnectOnPanic {
+			socket.Close()
+		}
+
+		resp, err = nil, errInternal
+	}()
+
+	return e.wrapHandler(handler)(ctx, socket, event, data)
+}
+
+// callServerSideHandler calls handler and
+// recovers from panic in it, if any.
+func (e *Engine) callServerSideHandler(ctx context.Context, handler ServerSideHandler, event string, args []json.RawMessage) (resp any, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		e.metrics.HandlerPanics.Inc()
+		e.reportError(nil, &PanicError{
+			Event: event,
+			Value: v,
+			Stack: debug.Stack(),
+		})
+
+		resp, err = nil, errInternal
+	}()
+
+	return handler(ctx, event, args)
+}
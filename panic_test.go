@@ -0,0 +1,61 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_HandlerPanic(t *testing.T) {
+	errs := make(chan error, 1)
+
+	e := newTestEngine()
+	e.OnError = func(_ *Socket, err error) {
+		errs <- err
+	}
+	e.On("panic", func(context.Context, *Socket, string, []byte) (any, error) {
+		panic("boom")
+	})
+	e.On("ok", func(context.Context, *Socket, string, []byte) (any, error) {
+		return "ok", nil
+	})
+
+	conn := connectClient(t, e)
+
+	conn.ClientSend(`421["panic"]`)
+	assert.Equal(t, `431[{"error":"internal server error"}]`, conn.ClientRead(t))
+
+	var panicErr *PanicError
+	require.ErrorAs(t, <-errs, &panicErr)
+	assert.Equal(t, "panic", panicErr.Event)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.NotEmpty(t, panicErr.Stack)
+
+	// Socket is still alive.
+	conn.ClientSend(`422["ok"]`)
+	assert.Equal(t, `432["ok"]`, conn.ClientRead(t))
+}
+
+func TestEngine_ServerSideHandlerPanic(t *testing.T) {
+	errs := make(chan error, 1)
+
+	e := newTestEngine()
+	e.OnError = func(s *Socket, err error) {
+		assert.Nil(t, s)
+		errs <- err
+	}
+	e.OnServerSide("panic", func(context.Context, string, []json.RawMessage) (any, error) {
+		panic("boom")
+	})
+
+	ack := e.ReceivedServerSide(context.Background(), "panic", nil)
+	assert.JSONEq(t, `{"error":"internal server error"}`, string(ack))
+
+	var panicErr *PanicError
+	require.ErrorAs(t, <-errs, &panicErr)
+	assert.Equal(t, "panic", panicErr.Event)
+	assert.Equal(t, "boom", panicErr.Value)
+}
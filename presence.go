@@ -0,0 +1,411 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPresenceCheckInterval is used if `Presence.CheckInterval` is not set.
+	DefaultPresenceCheckInterval = DefaultHeartbeatInterval
+	// DefaultPresenceNodeTimeout is used if `Presence.NodeTimeout` is not set.
+	DefaultPresenceNodeTimeout = 30 * time.Second
+
+	// presenceEvent is server-side event that notifies
+	// other nodes that user went online or offline.
+	presenceEvent = "socketio:presence"
+)
+
+// ErrPresenceStarted is returned when presence is started more than once.
+var ErrPresenceStarted = errors.New("presence is already started")
+
+// PresenceStore keeps sockets of users connected to any node.
+// Store is shared by all nodes.
+//
+// Nodes are identified by uids from `Engine.Nodes`.
+// Sockets of nodes that are no longer live are removed with `RemoveNode`.
+type PresenceStore interface {
+	// Connect adds socket of the user connected to the node.
+	// It returns true if user had no other sockets.
+	Connect(ctx context.Context, node, userID, socketID string) (first bool, err error)
+	// Disconnect removes socket of the user.
+	// It returns true if socket was removed and user has no other sockets.
+	Disconnect(ctx context.Context, node, userID, socketID string) (last bool, err error)
+	// IsOnline reports whether user has sockets.
+	IsOnline(ctx context.Context, userID string) (bool, error)
+	// OnlineUsers returns users that have sockets.
+	OnlineUsers(ctx context.Context) ([]string, error)
+	// Nodes returns nodes that have sockets.
+	Nodes(ctx context.Context) ([]string, error)
+	// RemoveNode removes sockets of the node and returns users that
+	// have no other sockets. Each user is returned to one caller only.
+	RemoveNode(ctx context.Context, node string) (offline []string, err error)
+}
+
+// PresenceHandler is called when user goes online or offline.
+type PresenceHandler func(ctx context.Context, userID string)
+
+// Presence tracks which users are online on any node.
+//
+// It is enabled by setting `Engine.Presence`. Only sockets
+// that have `UserID` set in `Engine.OnConnect` are tracked.
+//
+// Sockets are kept in the store under uid of the node in adapter.
+// Presence must be started with `Start` to remove sockets of nodes
+// that are no longer live, so their users go offline. Sockets of this
+// node are then added back if other node removed them by mistake.
+type Presence struct {
+	engine *Engine
+	store  PresenceStore
+
+	// OnOnline is called on every node when first socket of the user connects.
+	OnOnline PresenceHandler
+	// OnOffline is called on every node when last socket of the user
+	// disconnects or is removed with node that is no longer live.
+	OnOffline PresenceHandler
+	// CheckInterval is how often nodes in the store are compared with live nodes.
+	// If not set `DefaultPresenceCheckInterval` is used.
+	CheckInterval time.Duration
+	// NodeTimeout is how long node must be missing from `Engine.Nodes`
+	// before its sockets are removed. It covers time that adapter
+	// needs to learn about other nodes after start.
+	// If not set `DefaultPresenceNodeTimeout` is used.
+	NodeTimeout time.Duration
+	// OnError is called when sockets of nodes could not be removed
+	// or sockets of this node could not be added back.
+	OnError func(err error)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+	// missing maps nodes that are in the store, but
+	// are not live, to time when they were first missing.
+	missing map[string]time.Time
+}
+
+// NewPresence creates presence that keeps sockets of the engine in the store.
+// It should be set as `Engine.Presence` of the same engine.
+func NewPresence(engine *Engine, store PresenceStore) *Presence {
+	return &Presence{
+		engine: engine,
+		store:  store,
+	}
+}
+
+// Start removes sockets of nodes that are no longer live in
+// background until ctx is done or presence is closed.
+func (p *Presence) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		return ErrPresenceStarted
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.missing = make(map[string]time.Time)
+
+	go p.run(ctx)
+
+	return nil
+}
+
+// Close stops removing sockets of nodes that are no longer live.
+func (p *Presence) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+	<-p.done
+
+	p.cancel = nil
+
+	return nil
+}
+
+// IsOnline reports whether user has sockets on any node.
+func (p *Presence) IsOnline(ctx context.Context, userID string) (bool, error) {
+	return p.store.IsOnline(ctx, userID)
+}
+
+// OnlineUsers returns users that have sockets on any node.
+func (p *Presence) OnlineUsers(ctx context.Context) ([]string, error) {
+	return p.store.OnlineUsers(ctx)
+}
+
+func (p *Presence) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := p.check(ctx, now); err != nil && ctx.Err() == nil {
+				p.reportError(fmt.Errorf("check presence: %w", err))
+			}
+		}
+	}
+}
+
+// check removes sockets of nodes that were
+// missing from live nodes for `NodeTimeout`.
+//
+// Nothing is removed while adapter is not healthy, as live nodes
+// are not known then. Sockets of this node are added to the store
+// again, in case they were removed while this node was not live.
+func (p *Presence) check(ctx context.Context, now time.Time) error {
+	if adapter, ok := p.engine.adapter.(interface{ Healthy() bool }); ok && !adapter.Healthy() {
+		// Time that nodes are missing is counted
+		// again when adapter is healthy.
+		p.missing = make(map[string]time.Time)
+
+		return nil
+	}
+
+	p.assertLocal(ctx)
+
+	nodes, err := p.store.Nodes(ctx)
+	if err != nil {
+		return fmt.Errorf("list nodes: %w", err)
+	}
+
+	live := make(map[string]struct{})
+	for _, node := range p.engine.Nodes() {
+		live[node.UID] = struct{}{}
+	}
+
+	missing := make(map[string]time.Time)
+	for _, node := range nodes {
+		if _, ok := live[node]; ok {
+			continue
+		}
+
+		since, ok := p.missing[node]
+		if !ok {
+			since = now
+		}
+
+		if now.Sub(since) < p.nodeTimeout() {
+			missing[node] = since
+			continue
+		}
+
+		offline, err := p.store.RemoveNode(ctx, node)
+		if err != nil {
+			missing[node] = since
+			p.reportError(fmt.Errorf("remove node %q: %w", node, err))
+
+			continue
+		}
+
+		for _, userID := range offline {
+			if err := p.changed(ctx, userID, false); err != nil {
+				p.reportError(err)
+			}
+		}
+	}
+
+	p.missing = missing
+
+	return nil
+}
+
+// assertLocal adds sockets of this node to the store.
+func (p *Presence) assertLocal(ctx context.Context) {
+	for socketID, userID := range p.engine.localUsers() {
+		if err := p.connected(ctx, userID, socketID); err != nil {
+			p.reportError(err)
+			continue
+		}
+
+		// Socket that disconnected meanwhile could be added back.
+		if !p.engine.isLocal(socketID) {
+			if err := p.disconnected(ctx, userID, socketID); err != nil {
+				p.reportError(err)
+			}
+		}
+	}
+}
+
+func (p *Presence) connected(ctx context.Context, userID, socketID string) error {
+	first, err := p.store.Connect(ctx, p.engine.uid(), userID, socketID)
+	if err != nil {
+		return fmt.Errorf("presence connect: %w", err)
+	}
+
+	if first {
+		return p.changed(ctx, userID, true)
+	}
+
+	return nil
+}
+
+func (p *Presence) disconnected(ctx context.Context, userID, socketID string) error {
+	last, err := p.store.Disconnect(ctx, p.engine.uid(), userID, socketID)
+	if err != nil {
+		return fmt.Errorf("presence disconnect: %w", err)
+	}
+
+	if last {
+		return p.changed(ctx, userID, false)
+	}
+
+	return nil
+}
+
+// changed calls handler of this node and notifies
+// other nodes that user went online or offline.
+func (p *Presence) changed(ctx context.Context, userID string, online bool) error {
+	p.handle(ctx, userID, online)
+
+	if err := p.engine.ServerSideEmit(ctx, presenceEvent, userID, online); err != nil {
+		return fmt.Errorf("notify presence: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Presence) handle(ctx context.Context, userID string, online bool) {
+	handler := p.OnOffline
+	if online {
+		handler = p.OnOnline
+	}
+
+	if handler != nil {
+		handler(ctx, userID)
+	}
+}
+
+func (p *Presence) reportError(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
+
+func (p *Presence) checkInterval() time.Duration {
+	if p.CheckInterval <= 0 {
+		return DefaultPresenceCheckInterval
+	}
+
+	return p.CheckInterval
+}
+
+func (p *Presence) nodeTimeout() time.Duration {
+	if p.NodeTimeout <= 0 {
+		return DefaultPresenceNodeTimeout
+	}
+
+	return p.NodeTimeout
+}
+
+// handlePresence handles presence change sent by other node.
+func (e *Engine) handlePresence(ctx context.Context, _ string, args []json.RawMessage) (any, error) {
+	if e.Presence == nil || len(args) != 2 {
+		return nil, nil
+	}
+
+	var userID string
+	if err := json.Unmarshal(args[0], &userID); err != nil {
+		return nil, err
+	}
+
+	var online bool
+	if err := json.Unmarshal(args[1], &online); err != nil {
+		return nil, err
+	}
+
+	e.Presence.handle(ctx, userID, online)
+
+	return nil, nil
+}
+
+// localUsers maps sockets of this node that have user to their users.
+func (e *Engine) localUsers() map[string]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	users := make(map[string]string)
+	for id, socket := range e.sockets {
+		if socket.UserID != "" {
+			users[id] = socket.UserID
+		}
+	}
+
+	return users
+}
+
+// isLocal reports whether socket is connected to this node.
+func (e *Engine) isLocal(socketID string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	_, ok := e.sockets[socketID]
+
+	return ok
+}
+
+// uid returns uid of this node in the adapter.
+func (e *Engine) uid() string {
+	for _, node := range e.Nodes() {
+		if node.Self {
+			return node.UID
+		}
+	}
+
+	return ""
+}
+
+// IsOnline reports whether user has sockets on any node.
+//
+// If `Presence` is not set, sockets of the user are fetched
+// from all nodes through the adapter.
+func (e *Engine) IsOnline(ctx context.Context, userID string) (bool, error) {
+	if e.Presence != nil {
+		return e.Presence.IsOnline(ctx, userID)
+	}
+
+	sockets, err := e.To(UserRoom(userID)).FetchSockets(ctx)
+	if len(sockets) != 0 {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// OnlineUsers returns users that have sockets on any node.
+//
+// If `Presence` is not set, sockets are fetched
+// from all nodes through the adapter.
+func (e *Engine) OnlineUsers(ctx context.Context) ([]string, error) {
+	if e.Presence != nil {
+		return e.Presence.OnlineUsers(ctx)
+	}
+
+	sockets, err := e.FetchSockets(ctx)
+
+	seen := make(map[string]struct{})
+	users := make([]string, 0, len(sockets))
+	for _, s := range sockets {
+		if _, ok := seen[s.UserID]; ok || s.UserID == "" {
+			continue
+		}
+
+		seen[s.UserID] = struct{}{}
+		users = append(users, s.UserID)
+	}
+
+	return users, err
+}
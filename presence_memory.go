@@ -0,0 +1,115 @@
+package socketio
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+var _ PresenceStore = &MemoryPresenceStore{}
+
+// MemoryPresenceStore keeps presence in memory.
+// It can be shared only by engines in the same process,
+// so it is suitable for single node and tests.
+type MemoryPresenceStore struct {
+	mu sync.Mutex
+	// users maps user to its sockets and nodes they are connected to.
+	users map[string]map[string]string
+	// nodeSockets maps node to its sockets and their users.
+	nodeSockets map[string]map[string]string
+}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{
+		users:       make(map[string]map[string]string),
+		nodeSockets: make(map[string]map[string]string),
+	}
+}
+
+func (s *MemoryPresenceStore) Connect(_ context.Context, node, userID, socketID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := len(s.users[userID]) == 0
+
+	if s.users[userID] == nil {
+		s.users[userID] = make(map[string]string)
+	}
+	s.users[userID][socketID] = node
+
+	if s.nodeSockets[node] == nil {
+		s.nodeSockets[node] = make(map[string]string)
+	}
+	s.nodeSockets[node][socketID] = userID
+
+	return first, nil
+}
+
+// Disconnect removes socket from the node it was connected to.
+func (s *MemoryPresenceStore) Disconnect(_ context.Context, _, userID, socketID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.users[userID][socketID]
+	if !ok {
+		return false, nil
+	}
+
+	return s.removeUnsafe(node, userID, socketID), nil
+}
+
+func (s *MemoryPresenceStore) IsOnline(_ context.Context, userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.users[userID]) != 0, nil
+}
+
+// OnlineUsers returns online users sorted by id.
+func (s *MemoryPresenceStore) OnlineUsers(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := keys(s.users)
+	sort.Strings(users)
+
+	return users, nil
+}
+
+func (s *MemoryPresenceStore) Nodes(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return keys(s.nodeSockets), nil
+}
+
+func (s *MemoryPresenceStore) RemoveNode(_ context.Context, node string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var offline []string
+	for socketID, userID := range s.nodeSockets[node] {
+		if s.removeUnsafe(node, userID, socketID) {
+			offline = append(offline, userID)
+		}
+	}
+
+	return offline, nil
+}
+
+// removeUnsafe removes socket and reports whether user has no other sockets.
+func (s *MemoryPresenceStore) removeUnsafe(node, userID, socketID string) bool {
+	delete(s.nodeSockets[node], socketID)
+	if len(s.nodeSockets[node]) == 0 {
+		delete(s.nodeSockets, node)
+	}
+
+	delete(s.users[userID], socketID)
+	if len(s.users[userID]) != 0 {
+		return false
+	}
+
+	delete(s.users, userID)
+
+	return true
+}
@@ -0,0 +1,160 @@
+package socketio
+
+import (
+	"context"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ PresenceStore = &RedisPresenceStore{}
+
+var (
+	// KEYS: nodes, user, users, node. ARGV: node, user id, socket id.
+	presenceConnectScript = redis.NewScript(`
+local first = redis.call('HLEN', KEYS[2]) == 0
+
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[1])
+redis.call('SADD', KEYS[3], ARGV[2])
+redis.call('HSET', KEYS[4], ARGV[3], ARGV[2])
+redis.call('SADD', KEYS[1], ARGV[1])
+
+if first then
+	return 1
+end
+
+return 0
+`)
+
+	// KEYS: nodes, user, users. ARGV: user id, socket id, node key prefix.
+	presenceDisconnectScript = redis.NewScript(`
+local node = redis.call('HGET', KEYS[2], ARGV[2])
+if not node then
+	return 0
+end
+
+redis.call('HDEL', KEYS[2], ARGV[2])
+redis.call('HDEL', ARGV[3] .. node, ARGV[2])
+
+if redis.call('HLEN', ARGV[3] .. node) == 0 then
+	redis.call('SREM', KEYS[1], node)
+end
+
+if redis.call('HLEN', KEYS[2]) ~= 0 then
+	return 0
+end
+
+redis.call('SREM', KEYS[3], ARGV[1])
+
+return 1
+`)
+
+	// KEYS: nodes, users, node. ARGV: node, user key prefix.
+	presenceRemoveNodeScript = redis.NewScript(`
+local offline = {}
+
+local sockets = redis.call('HGETALL', KEYS[3])
+for i = 1, #sockets, 2 do
+	local userKey = ARGV[2] .. sockets[i + 1]
+
+	redis.call('HDEL', userKey, sockets[i])
+	if redis.call('HLEN', userKey) == 0 and redis.call('SREM', KEYS[2], sockets[i + 1]) == 1 then
+		table.insert(offline, sockets[i + 1])
+	end
+end
+
+redis.call('DEL', KEYS[3])
+redis.call('SREM', KEYS[1], ARGV[1])
+
+return offline
+`)
+)
+
+// RedisPresenceStore keeps presence in Redis, so it can be shared by all nodes.
+//
+// Keys share hash tag, so they are in the same slot of Redis Cluster.
+type RedisPresenceStore struct {
+	r      redis.UniversalClient
+	prefix string
+}
+
+// NewRedisPresenceStore creates store with keys that start with "{prefix}:".
+// If prefix is empty - "presence" is used.
+func NewRedisPresenceStore(r redis.UniversalClient, prefix string) *RedisPresenceStore {
+	if prefix == "" {
+		prefix = "presence"
+	}
+
+	return &RedisPresenceStore{
+		r:      r,
+		prefix: "{" + prefix + "}:",
+	}
+}
+
+func (s *RedisPresenceStore) Connect(ctx context.Context, node, userID, socketID string) (bool, error) {
+	first, err := presenceConnectScript.Run(ctx, s.r,
+		[]string{s.nodesKey(), s.userKey(userID), s.usersKey(), s.nodeKey(node)},
+		node, userID, socketID,
+	).Int()
+
+	return first == 1, err
+}
+
+// Disconnect removes socket from the node it was connected to.
+func (s *RedisPresenceStore) Disconnect(ctx context.Context, _, userID, socketID string) (bool, error) {
+	last, err := presenceDisconnectScript.Run(ctx, s.r,
+		[]string{s.nodesKey(), s.userKey(userID), s.usersKey()},
+		userID, socketID, s.nodeKey(""),
+	).Int()
+
+	return last == 1, err
+}
+
+func (s *RedisPresenceStore) IsOnline(ctx context.Context, userID string) (bool, error) {
+	n, err := s.r.Exists(ctx, s.userKey(userID)).Result()
+
+	return n == 1, err
+}
+
+// OnlineUsers returns online users sorted by id.
+func (s *RedisPresenceStore) OnlineUsers(ctx context.Context) ([]string, error) {
+	users, err := s.r.SMembers(ctx, s.usersKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(users)
+
+	return users, nil
+}
+
+func (s *RedisPresenceStore) Nodes(ctx context.Context) ([]string, error) {
+	return s.r.SMembers(ctx, s.nodesKey()).Result()
+}
+
+func (s *RedisPresenceStore) RemoveNode(ctx context.Context, node string) ([]string, error) {
+	return presenceRemoveNodeScript.Run(ctx, s.r,
+		[]string{s.nodesKey(), s.usersKey(), s.nodeKey(node)},
+		node, s.userKey(""),
+	).StringSlice()
+}
+
+// nodesKey is set of nodes that have sockets.
+func (s *RedisPresenceStore) nodesKey() string {
+	return s.prefix + "nodes"
+}
+
+// usersKey is set of users that have sockets.
+func (s *RedisPresenceStore) usersKey() string {
+	return s.prefix + "users"
+}
+
+// userKey is hash that maps sockets of the user to their nodes.
+func (s *RedisPresenceStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
+
+// nodeKey is hash that maps sockets of the node to their users.
+func (s *RedisPresenceStore) nodeKey(node string) string {
+	return s.prefix + "node:" + node
+}
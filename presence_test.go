@@ -0,0 +1,110 @@
+package socketio_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	socketio "github.com/ffenix113/go-socketio"
+)
+
+func TestPresenceStores(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T) socketio.PresenceStore
+	}{
+		{
+			name: "Memory",
+			newStore: func(t *testing.T) socketio.PresenceStore {
+				return socketio.NewMemoryPresenceStore()
+			},
+		},
+		{
+			name: "Redis",
+			newStore: func(t *testing.T) socketio.PresenceStore {
+				return socketio.NewRedisPresenceStore(newRedisClient(t, miniredis.RunT(t)), "")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := test.newStore(t)
+
+			first, err := s.Connect(ctx, "node1", "alice", "s1")
+			require.NoError(t, err)
+			assert.True(t, first)
+
+			first, err = s.Connect(ctx, "node2", "alice", "s2")
+			require.NoError(t, err)
+			assert.False(t, first)
+
+			_, err = s.Connect(ctx, "node2", "bob", "s3")
+			require.NoError(t, err)
+
+			online, err := s.IsOnline(ctx, "alice")
+			require.NoError(t, err)
+			assert.True(t, online)
+
+			users, err := s.OnlineUsers(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"alice", "bob"}, users)
+
+			last, err := s.Disconnect(ctx, "node1", "alice", "s1")
+			require.NoError(t, err)
+			assert.False(t, last)
+
+			last, err = s.Disconnect(ctx, "node2", "alice", "s2")
+			require.NoError(t, err)
+			assert.True(t, last)
+
+			// Unknown socket is not reported as last.
+			last, err = s.Disconnect(ctx, "node2", "alice", "s2")
+			require.NoError(t, err)
+			assert.False(t, last)
+
+			online, err = s.IsOnline(ctx, "alice")
+			require.NoError(t, err)
+			assert.False(t, online)
+
+			// Sockets of removed node are removed, and users
+			// that have no other sockets are returned once.
+			_, err = s.Connect(ctx, "node1", "carol", "s4")
+			require.NoError(t, err)
+			_, err = s.Connect(ctx, "node1", "carol", "s5")
+			require.NoError(t, err)
+			_, err = s.Connect(ctx, "node1", "bob", "s6")
+			require.NoError(t, err)
+
+			nodes, err := s.Nodes(ctx)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"node1", "node2"}, nodes)
+
+			offline, err := s.RemoveNode(ctx, "node1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"carol"}, offline)
+
+			offline, err = s.RemoveNode(ctx, "node1")
+			require.NoError(t, err)
+			assert.Empty(t, offline)
+
+			users, err = s.OnlineUsers(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"bob"}, users)
+
+			nodes, err = s.Nodes(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"node2"}, nodes)
+
+			// User is reported as new when it connects again.
+			first, err = s.Connect(ctx, "node1", "carol", "s7")
+			require.NoError(t, err)
+			assert.True(t, first)
+		})
+	}
+}
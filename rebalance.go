@@ -0,0 +1,301 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRebalanceInterval is used if `Rebalancer.Interval` is not set.
+	DefaultRebalanceInterval = time.Minute
+	// DefaultRebalanceTolerance is used if `Rebalancer.Tolerance` is not set.
+	DefaultRebalanceTolerance = 0.1
+	// DefaultRebalanceWindow is used if `Rebalancer.Window` is not set.
+	DefaultRebalanceWindow = 30 * time.Second
+
+	// socketCountEvent is server-side event that
+	// returns number of sockets of the node.
+	socketCountEvent = "socketio:socket-count"
+)
+
+// ErrRebalancerStarted is returned when rebalancer is started more than once.
+var ErrRebalancerStarted = errors.New("rebalancer is already started")
+
+// RebalanceOptions define which sockets `Engine.Rebalance` disconnects and how.
+type RebalanceOptions struct {
+	// Fraction of local sockets to disconnect, from 0 to 1.
+	Fraction float64
+	// Window is time over which disconnects are spread evenly.
+	// Zero value disconnects all selected sockets at once.
+	Window time.Duration
+	// Event is emitted with `RebalanceHint` to each
+	// socket right before it is disconnected.
+	// If empty - sockets are disconnected without it.
+	Event string
+	// ReconnectDelay is maximum delay that client is asked to
+	// wait before reconnecting. Each socket gets random delay,
+	// so clients do not reconnect all at once.
+	ReconnectDelay time.Duration
+}
+
+// RebalanceHint is data of `RebalanceOptions.Event`.
+type RebalanceHint struct {
+	// ReconnectDelay is delay in milliseconds that
+	// client should wait before reconnecting.
+	ReconnectDelay int64 `json:"reconnectDelay"`
+}
+
+// Rebalance disconnects randomly selected local sockets, so they
+// reconnect, possibly to other nodes. Sockets are closed the same
+// way as on `Shutdown`, so clients reconnect automatically.
+//
+// It blocks until all selected sockets are disconnected or ctx is done,
+// and returns number of disconnected sockets.
+func (e *Engine) Rebalance(ctx context.Context, opts RebalanceOptions) (int, error) {
+	e.mu.RLock()
+	sockets := make([]*Socket, 0, len(e.sockets))
+	for _, socket := range e.sockets {
+		sockets = append(sockets, socket)
+	}
+	e.mu.RUnlock()
+
+	fraction := math.Min(math.Max(opts.Fraction, 0), 1)
+	count := int(math.Round(float64(len(sockets)) * fraction))
+	if count == 0 {
+		return 0, nil
+	}
+
+	rand.Shuffle(len(sockets), func(i, j int) {
+		sockets[i], sockets[j] = sockets[j], sockets[i]
+	})
+
+	interval := opts.Window / time.Duration(count)
+
+	var disconnected int
+	for i, socket := range sockets[:count] {
+		if i != 0 && interval > 0 {
+			timer := time.NewTimer(interval)
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+
+				return disconnected, ctx.Err()
+			}
+		}
+
+		// Socket could disconnect while waiting.
+		if socket.Context().Err() != nil {
+			continue
+		}
+
+		if opts.Event != "" {
+			var delay time.Duration
+			if opts.ReconnectDelay > 0 {
+				delay = time.Duration(rand.Int63n(int64(opts.ReconnectDelay)))
+			}
+
+			packet, err := e.eventPacket(opts.Event, RebalanceHint{ReconnectDelay: delay.Milliseconds()})
+			if err != nil {
+				return disconnected, err
+			}
+
+			e.writeToClient(socket, packet)
+		}
+
+		socket.Close()
+
+		disconnected++
+		e.metrics.Rebalanced.Inc()
+	}
+
+	return disconnected, nil
+}
+
+// Rebalancer periodically compares number of local sockets
+// with average number of sockets on all nodes, and disconnects
+// sockets over the average with `Engine.Rebalance`.
+//
+// Nodes are taken from `Engine.Nodes`, and their socket counts are
+// requested with server-side event. Check is skipped if not all
+// nodes respond. Each node should run its own rebalancer.
+type Rebalancer struct {
+	engine *Engine
+
+	// Interval is how often sockets are compared.
+	// It should be longer than Window.
+	// If not set `DefaultRebalanceInterval` is used.
+	Interval time.Duration
+	// Tolerance is fraction of average that node can
+	// exceed it by before its sockets are disconnected.
+	// If not set `DefaultRebalanceTolerance` is used.
+	Tolerance float64
+	// Window is passed to `RebalanceOptions`.
+	// If not set `DefaultRebalanceWindow` is used.
+	Window time.Duration
+	// Event is passed to `RebalanceOptions`.
+	Event string
+	// ReconnectDelay is passed to `RebalanceOptions`.
+	ReconnectDelay time.Duration
+	// OnError is called when check fails.
+	OnError func(err error)
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRebalancer creates rebalancer of engine's local sockets.
+func NewRebalancer(engine *Engine) *Rebalancer {
+	return &Rebalancer{
+		engine: engine,
+	}
+}
+
+// Start checks sockets in background until ctx is done or rebalancer is closed.
+func (r *Rebalancer) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return ErrRebalancerStarted
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go r.run(ctx)
+
+	return nil
+}
+
+// Close stops checking sockets. Rebalancing in progress is stopped,
+// and sockets that were not disconnected yet stay connected.
+func (r *Rebalancer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel == nil {
+		return nil
+	}
+
+	r.cancel()
+	<-r.done
+
+	r.cancel = nil
+
+	return nil
+}
+
+// Check compares number of local sockets with average
+// number of sockets on all nodes and disconnects those over it.
+// It returns number of disconnected sockets.
+func (r *Rebalancer) Check(ctx context.Context) (int, error) {
+	nodes := len(r.engine.Nodes())
+	if nodes < 2 {
+		return 0, nil
+	}
+
+	acks, err := r.engine.ServerSideEmitWithAck(ctx, socketCountEvent)
+	if err != nil {
+		return 0, fmt.Errorf("request socket counts: %w", err)
+	}
+
+	local := r.engine.localSockets()
+	total, counted := local, 1
+
+	for _, ack := range acks {
+		// Nodes without rebalancing support acknowledge with null.
+		var count *int
+		if err := json.Unmarshal(ack, &count); err != nil {
+			return 0, fmt.Errorf("decode socket count: %w", err)
+		}
+
+		if count != nil {
+			total += *count
+			counted++
+		}
+	}
+
+	// Average would be wrong if not all nodes were counted,
+	// for example if node joined or left since nodes were listed.
+	if counted != nodes {
+		return 0, nil
+	}
+
+	average := float64(total) / float64(nodes)
+	if float64(local) <= average*(1+r.tolerance()) {
+		return 0, nil
+	}
+
+	excess := float64(local) - math.Ceil(average)
+
+	return r.engine.Rebalance(ctx, RebalanceOptions{
+		Fraction:       excess / float64(local),
+		Window:         r.window(),
+		Event:          r.Event,
+		ReconnectDelay: r.ReconnectDelay,
+	})
+}
+
+func (r *Rebalancer) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Check(ctx); err != nil && ctx.Err() == nil && r.OnError != nil {
+				r.OnError(fmt.Errorf("rebalance: %w", err))
+			}
+		}
+	}
+}
+
+func (r *Rebalancer) interval() time.Duration {
+	if r.Interval <= 0 {
+		return DefaultRebalanceInterval
+	}
+
+	return r.Interval
+}
+
+func (r *Rebalancer) tolerance() float64 {
+	if r.Tolerance <= 0 {
+		return DefaultRebalanceTolerance
+	}
+
+	return r.Tolerance
+}
+
+func (r *Rebalancer) window() time.Duration {
+	if r.Window <= 0 {
+		return DefaultRebalanceWindow
+	}
+
+	return r.Window
+}
+
+// localSockets returns number of sockets connected to this node.
+func (e *Engine) localSockets() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return len(e.sockets)
+}
+
+// handleSocketCount handles request of socket count from other node.
+func (e *Engine) handleSocketCount(context.Context, string, []json.RawMessage) (any, error) {
+	return e.localSockets(), nil
+}
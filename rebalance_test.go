@@ -0,0 +1,109 @@
+package socketio
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Rebalance(t *testing.T) {
+	e := newTestEngine()
+
+	conns := make([]*Conn, 4)
+	for i := range conns {
+		conns[i] = connectClient(t, e)
+	}
+
+	n, err := e.Rebalance(context.Background(), RebalanceOptions{
+		Fraction:       0.5,
+		Window:         40 * time.Millisecond,
+		Event:          "rebalance",
+		ReconnectDelay: time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, e.localSockets())
+
+	// Connections are closed after queued packets are sent.
+	closed := func() []*Conn {
+		var closed []*Conn
+		for _, conn := range conns {
+			if conn.ctx.Err() != nil {
+				closed = append(closed, conn)
+			}
+		}
+
+		return closed
+	}
+
+	require.Eventually(t, func() bool {
+		return len(closed()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	hintRe := regexp.MustCompile(`^42\["rebalance",\{"reconnectDelay":\d+\}\]$`)
+	for _, conn := range closed() {
+		// Hint is sent before close packet.
+		assert.Regexp(t, hintRe, conn.ClientRead(t))
+		assert.Equal(t, `1`, conn.ClientRead(t))
+	}
+}
+
+func TestRebalancer_Check(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	newEngine := func() *Engine {
+		r := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		t.Cleanup(func() { _ = r.Close() })
+
+		a := NewRedisAdapter(nil, r, "")
+		a.HeartbeatInterval = 20 * time.Millisecond
+
+		e := NewEngine(nil, time.Minute, time.Second, read, write, nil, a)
+
+		require.NoError(t, a.Start(ctx))
+		t.Cleanup(func() { _ = a.Close() })
+
+		return e
+	}
+
+	busy, idle := newEngine(), newEngine()
+	require.Eventually(t, func() bool {
+		return len(busy.Nodes()) == 2 && len(idle.Nodes()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		connectClient(t, busy)
+	}
+	connectClient(t, idle)
+
+	newRebalancer := func(e *Engine) *Rebalancer {
+		r := NewRebalancer(e)
+		r.Tolerance = 0.5
+		r.Window = time.Millisecond
+
+		return r
+	}
+
+	// Node with less sockets than average keeps them.
+	n, err := newRebalancer(idle).Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Node over average with tolerance disconnects sockets above average.
+	n, err = newRebalancer(busy).Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 3, busy.localSockets())
+
+	// Node within tolerance keeps its sockets.
+	n, err = newRebalancer(busy).Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -0,0 +1,358 @@
+package socketio
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultReliableTimeout is used if `Engine.ReliableTimeout` is not set.
+	DefaultReliableTimeout = 30 * time.Second
+	// DefaultReliableRetryInterval is used if `Engine.ReliableRetryInterval` is not set.
+	DefaultReliableRetryInterval = time.Second
+	// DefaultReliableMaxRetryInterval is used if `Engine.ReliableMaxRetryInterval` is not set.
+	DefaultReliableMaxRetryInterval = 10 * time.Second
+
+	// reliableAckEvent is server-side event that forwards acknowledgement
+	// to the node that emitted the message.
+	reliableAckEvent = "socketio:reliable-ack"
+)
+
+// DeliveryStatus is final status of reliable message.
+type DeliveryStatus string
+
+const (
+	// DeliveryAcked means that client acknowledged the message.
+	DeliveryAcked DeliveryStatus = "acked"
+	// DeliveryExpired means that message was not acknowledged
+	// before `Engine.ReliableTimeout` passed.
+	DeliveryExpired DeliveryStatus = "expired"
+	// DeliveryDisconnected means that socket the message
+	// was emitted to disconnected before acknowledging it.
+	DeliveryDisconnected DeliveryStatus = "disconnected"
+	// DeliveryCanceled means that engine was shut down
+	// before message was acknowledged.
+	DeliveryCanceled DeliveryStatus = "canceled"
+)
+
+// DeliveryReport is passed to `Engine.OnDelivery`
+// when delivery of reliable message is finished.
+type DeliveryReport struct {
+	// MessageID is id returned by the emit call.
+	MessageID string
+	Event     string
+	Status    DeliveryStatus
+	// Attempts is number of times message was sent.
+	Attempts int
+	// Ack is data that client acknowledged message with.
+	Ack json.RawMessage
+}
+
+// ReliableMeta is appended to arguments of reliable event.
+// Client should acknowledge the event and ignore
+// events with ids that it has already handled,
+// as the same event can be delivered more than once.
+type ReliableMeta struct {
+	ID string `json:"id"`
+}
+
+type reliableMessage struct {
+	id    string
+	event string
+	acks  chan json.RawMessage
+}
+
+// EmitReliable sends event to the socket with acknowledgement
+// and resends it with backoff until client acknowledges it,
+// socket disconnects, `Engine.ReliableTimeout` passes
+// or engine is shut down.
+//
+// Event is sent with `ReliableMeta` as its last argument.
+// Returned id is the id of the message in the meta and in the
+// report that is passed to `Engine.OnDelivery`.
+func (s *Socket) EmitReliable(event string, data any) (string, error) {
+	return s.socketEngine.emitReliable(s.ctx, event, data, func(packet Packet) error {
+		s.socketEngine.writeToClient(s, packet)
+		return nil
+	})
+}
+
+// EmitReliableForUser sends event to all sockets of the user
+// on any node, and resends it with backoff until any of them
+// acknowledges it or `Engine.ReliableTimeout` passes.
+// Sockets of the user that connect before that
+// will receive the event on the next attempt.
+//
+// See `Socket.EmitReliable` for details.
+func (e *Engine) EmitReliableForUser(ctx context.Context, userID, event string, data any) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return e.emitReliable(context.Background(), event, data, func(packet Packet) error {
+		return e.adapter.Broadcast(context.Background(), packet, BroadcastOptions{Rooms: []string{UserRoom(userID)}})
+	})
+}
+
+// emitReliable sends event with send until it is acknowledged.
+// Delivery is stopped with DeliveryDisconnected when ctx is done.
+func (e *Engine) emitReliable(ctx context.Context, event string, data any, send func(packet Packet) error) (string, error) {
+	bts, err := e.codec.MarashalJSON(data)
+	if err != nil {
+		return "", fmt.Errorf("encode %q event data: %w", event, err)
+	}
+
+	msg := &reliableMessage{
+		id:    newID(),
+		event: event,
+		acks:  make(chan json.RawMessage, 1),
+	}
+
+	dataBts, err := json.Marshal([3]any{event, json.RawMessage(bts), ReliableMeta{ID: msg.id}})
+	if err != nil {
+		return "", fmt.Errorf("encode %q event: %w", event, err)
+	}
+
+	ackID := e.addReliable(msg)
+
+	packet := Packet{
+		Type:      PacketTypeEvent,
+		Namespace: DefaultNamespace,
+		AckID:     &ackID,
+		Data:      dataBts,
+	}
+
+	e.metrics.ReliablePending.Inc()
+
+	go e.deliverReliable(ctx, ackID, msg, packet, send)
+
+	return msg.id, nil
+}
+
+func (e *Engine) deliverReliable(ctx context.Context, ackID int, msg *reliableMessage, packet Packet, send func(packet Packet) error) {
+	report := DeliveryReport{
+		MessageID: msg.id,
+		Event:     msg.event,
+		Status:    DeliveryExpired,
+	}
+
+	deadline := time.NewTimer(e.reliableTimeout())
+	defer deadline.Stop()
+
+	interval := e.reliableRetryInterval()
+
+loop:
+	for {
+		if report.Attempts != 0 {
+			e.metrics.ReliableRetries.Inc()
+		}
+
+		report.Attempts++
+		// Errors are not reported, as message will be sent again.
+		_ = send(packet)
+
+		retry := time.NewTimer(interval)
+
+		select {
+		case report.Ack = <-msg.acks:
+			retry.Stop()
+			report.Status = DeliveryAcked
+
+			break loop
+		case <-deadline.C:
+			retry.Stop()
+
+			break loop
+		case <-ctx.Done():
+			retry.Stop()
+			report.Status = DeliveryDisconnected
+
+			break loop
+		case <-e.closed:
+			retry.Stop()
+			report.Status = DeliveryCanceled
+
+			break loop
+		case <-retry.C:
+		}
+
+		if interval *= 2; interval > e.reliableMaxRetryInterval() {
+			interval = e.reliableMaxRetryInterval()
+		}
+	}
+
+	e.removeReliable(ackID)
+
+	e.metrics.ReliablePending.Dec()
+	e.metrics.ReliableFinished.WithLabelValues(string(report.Status)).Inc()
+
+	if e.OnDelivery != nil {
+		e.OnDelivery(report)
+	}
+}
+
+// addReliable stores message and returns ack id that
+// is used for all attempts of the message.
+func (e *Engine) addReliable(msg *reliableMessage) int {
+	e.reliableMu.Lock()
+	defer e.reliableMu.Unlock()
+
+	if e.reliable == nil {
+		e.reliable = make(map[int]*reliableMessage)
+	}
+
+	for {
+		// Acknowledgements can be received by other nodes,
+		// so ack ids are random to not collide with theirs.
+		// Ids are below 2^53 to be precise in JavaScript clients.
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+
+		ackID := int(binary.BigEndian.Uint64(b[:]) >> 11)
+		if _, ok := e.reliable[ackID]; !ok {
+			e.reliable[ackID] = msg
+			return ackID
+		}
+	}
+}
+
+func (e *Engine) removeReliable(ackID int) {
+	e.reliableMu.Lock()
+	defer e.reliableMu.Unlock()
+
+	delete(e.reliable, ackID)
+}
+
+// ackReliable passes acknowledgement to the message with ack id.
+// It returns false if there is no such message on this node.
+func (e *Engine) ackReliable(ackID int, data json.RawMessage) bool {
+	e.reliableMu.Lock()
+	msg, ok := e.reliable[ackID]
+	e.reliableMu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	select {
+	case msg.acks <- data:
+	default:
+		// Message is already acknowledged.
+	}
+
+	return true
+}
+
+// handleAck handles acknowledgement received from the socket.
+// Acknowledgements for messages emitted by other
+// nodes are forwarded to all nodes.
+func (e *Engine) handleAck(socket *Socket, packet Packet) {
+	if packet.AckID == nil {
+		return
+	}
+
+	sent := socket.takeReliable(*packet.AckID)
+
+	data := append(json.RawMessage(nil), packet.Data...)
+	if e.ackReliable(*packet.AckID, data) {
+		return
+	}
+
+	// Acknowledgements of events that were not sent to the socket
+	// are dropped, so client can not make node send them to all nodes.
+	if !sent {
+		return
+	}
+
+	ctx, cancel := e.handlerContext(socket.Context())
+	defer cancel()
+
+	if err := e.ServerSideEmit(ctx, reliableAckEvent, *packet.AckID, data); err != nil {
+		e.reportError(socket, fmt.Errorf("forward acknowledgement: %w", err))
+	}
+}
+
+// sentReliable records that reliable event with ack id was sent to the socket.
+// Ids sent longer than ttl ago are forgotten, as their messages expired.
+func (s *Socket) sentReliable(ackID int, now time.Time, ttl time.Duration) {
+	s.reliableMu.Lock()
+	defer s.reliableMu.Unlock()
+
+	if s.reliableAcks == nil {
+		s.reliableAcks = make(map[int]time.Time)
+	}
+
+	// Retries are sent with the same ack id.
+	if _, ok := s.reliableAcks[ackID]; ok {
+		return
+	}
+
+	for id, sentAt := range s.reliableAcks {
+		if now.Sub(sentAt) > ttl {
+			delete(s.reliableAcks, id)
+		}
+	}
+
+	s.reliableAcks[ackID] = now
+}
+
+// takeReliable reports whether reliable event with
+// ack id was sent to the socket, and forgets it.
+func (s *Socket) takeReliable(ackID int) bool {
+	s.reliableMu.Lock()
+	defer s.reliableMu.Unlock()
+
+	_, ok := s.reliableAcks[ackID]
+	delete(s.reliableAcks, ackID)
+
+	return ok
+}
+
+// handleRemoteAck handles acknowledgement forwarded by other node.
+func (e *Engine) handleRemoteAck(_ context.Context, _ string, args []json.RawMessage) (any, error) {
+	if len(args) != 2 {
+		return nil, nil
+	}
+
+	var ackID int
+	if err := json.Unmarshal(args[0], &ackID); err != nil {
+		return nil, err
+	}
+
+	var data json.RawMessage
+	if string(args[1]) != "null" {
+		data = args[1]
+	}
+
+	e.ackReliable(ackID, data)
+
+	return nil, nil
+}
+
+func (e *Engine) reliableTimeout() time.Duration {
+	if e.ReliableTimeout <= 0 {
+		return DefaultReliableTimeout
+	}
+
+	return e.ReliableTimeout
+}
+
+func (e *Engine) reliableRetryInterval() time.Duration {
+	if e.ReliableRetryInterval <= 0 {
+		return DefaultReliableRetryInterval
+	}
+
+	return e.ReliableRetryInterval
+}
+
+func (e *Engine) reliableMaxRetryInterval() time.Duration {
+	if e.ReliableMaxRetryInterval <= 0 {
+		return DefaultReliableMaxRetryInterval
+	}
+
+	return e.ReliableMaxRetryInterval
+}
@@ -0,0 +1,167 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var reliablePacketRe = regexp.MustCompile(`^42(\d+)\["pay",1,\{"id":"([^"]+)"\}\]$`)
+
+// readReliable reads reliable "pay" event and returns its ack id and message id.
+func readReliable(t *testing.T, conn *Conn) (string, string) {
+	t.Helper()
+
+	packet := conn.ClientRead(t)
+
+	match := reliablePacketRe.FindStringSubmatch(packet)
+	require.NotNil(t, match, "unexpected packet %q", packet)
+
+	return match[1], match[2]
+}
+
+func newReliableEngine(adapter Adapter) (*Engine, chan DeliveryReport) {
+	reports := make(chan DeliveryReport, 1)
+
+	e := NewEngine(nil, time.Minute, time.Second, read, write, nil, adapter)
+	e.ReliableRetryInterval = 20 * time.Millisecond
+	e.OnConnect = func(_ context.Context, s *Socket, _ string, data []byte) (any, error) {
+		s.UserID = string(data)
+		return nil, nil
+	}
+	e.OnDelivery = func(report DeliveryReport) {
+		reports <- report
+	}
+
+	return e, reports
+}
+
+func receiveReport(t *testing.T, reports chan DeliveryReport) DeliveryReport {
+	t.Helper()
+
+	select {
+	case report := <-reports:
+		return report
+	case <-time.After(time.Second):
+		require.FailNow(t, "delivery is not reported")
+		return DeliveryReport{}
+	}
+}
+
+func TestSocket_EmitReliable(t *testing.T) {
+	e, reports := newReliableEngine(nil)
+
+	var socket *Socket
+	e.On("subscribe", func(_ context.Context, s *Socket, _ string, _ []byte) (any, error) {
+		socket = s
+		return nil, nil
+	})
+
+	conn := connectUser(t, e, "alice")
+	conn.ClientSend(`421["subscribe"]`)
+	require.Equal(t, `431[null]`, conn.ClientRead(t))
+
+	id, err := socket.EmitReliable("pay", 1)
+	require.NoError(t, err)
+
+	// Message is resent with the same ids until it is acknowledged.
+	ackID, msgID := readReliable(t, conn)
+	assert.Equal(t, id, msgID)
+
+	retryAckID, retryMsgID := readReliable(t, conn)
+	assert.Equal(t, ackID, retryAckID)
+	assert.Equal(t, msgID, retryMsgID)
+
+	conn.ClientSend(`43` + ackID + `["ok"]`)
+
+	report := receiveReport(t, reports)
+	assert.Equal(t, id, report.MessageID)
+	assert.Equal(t, "pay", report.Event)
+	assert.Equal(t, DeliveryAcked, report.Status)
+	assert.GreaterOrEqual(t, report.Attempts, 2)
+	assert.JSONEq(t, `["ok"]`, string(report.Ack))
+
+	// Not acknowledged messages expire.
+	e.ReliableTimeout = 50 * time.Millisecond
+
+	_, err = socket.EmitReliable("pay", 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, DeliveryExpired, receiveReport(t, reports).Status)
+
+	// Messages to the socket are not resent after it disconnects.
+	e.ReliableTimeout = time.Minute
+
+	_, err = socket.EmitReliable("pay", 1)
+	require.NoError(t, err)
+
+	readReliable(t, conn)
+	conn.ClientSend(`41`)
+
+	assert.Equal(t, DeliveryDisconnected, receiveReport(t, reports).Status)
+}
+
+func TestEngine_EmitReliableForUser(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+
+	newEngine := func() (*Engine, chan DeliveryReport) {
+		r := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		t.Cleanup(func() { _ = r.Close() })
+
+		a := NewRedisAdapter(nil, r, "")
+		e, reports := newReliableEngine(a)
+
+		require.NoError(t, a.Start(ctx))
+		t.Cleanup(func() { _ = a.Close() })
+
+		return e, reports
+	}
+
+	sender, reports := newEngine()
+	other, _ := newEngine()
+
+	observer, _ := newEngine()
+	forwarded := make(chan []json.RawMessage, 2)
+	observer.OnServerSide(reliableAckEvent, func(_ context.Context, _ string, args []json.RawMessage) (any, error) {
+		forwarded <- args
+		return nil, nil
+	})
+
+	require.Eventually(t, func() bool {
+		return len(other.Nodes()) == 3
+	}, time.Second, 5*time.Millisecond)
+
+	id, err := sender.EmitReliableForUser(ctx, "alice", "pay", 1)
+	require.NoError(t, err)
+
+	// User that connects later receives message on the next attempt,
+	// and its acknowledgement is forwarded to the sender node.
+	conn := connectUser(t, other, "alice")
+
+	ackID, msgID := readReliable(t, conn)
+	assert.Equal(t, id, msgID)
+
+	// Acknowledgements of events that were not sent
+	// to the socket are not forwarded.
+	conn.ClientSend(`431[]`)
+	conn.ClientSend(`43` + ackID)
+
+	report := receiveReport(t, reports)
+	assert.Equal(t, id, report.MessageID)
+	assert.Equal(t, DeliveryAcked, report.Status)
+	assert.Equal(t, json.RawMessage(nil), report.Ack)
+
+	args := <-forwarded
+	assert.JSONEq(t, ackID, string(args[0]))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, forwarded)
+}
@@ -0,0 +1,40 @@
+package socketio
+
+import "context"
+
+// RemoteSocket is a snapshot of socket, that
+// can be connected to this or any other node.
+//
+// Commands are delivered through the adapter, so they
+// do nothing if socket is already disconnected.
+type RemoteSocket struct {
+	SocketInfo
+
+	engine *Engine
+}
+
+// Emit sends event to the socket.
+func (s RemoteSocket) Emit(ctx context.Context, event string, data any) error {
+	return s.operator().Emit(ctx, event, data)
+}
+
+// Join adds socket to rooms.
+func (s RemoteSocket) Join(ctx context.Context, rooms ...string) error {
+	return s.operator().SocketsJoin(ctx, rooms...)
+}
+
+// Leave removes socket from rooms.
+func (s RemoteSocket) Leave(ctx context.Context, rooms ...string) error {
+	return s.operator().SocketsLeave(ctx, rooms...)
+}
+
+// Disconnect disconnects the socket.
+func (s RemoteSocket) Disconnect(ctx context.Context) error {
+	return s.operator().DisconnectSockets(ctx)
+}
+
+// operator selects only this socket, as each
+// socket is in the room with its id.
+func (s RemoteSocket) operator() BroadcastOperator {
+	return s.engine.To(s.ID)
+}
@@ -0,0 +1,86 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ServerSideHandler handles event sent by other node
+// with `Engine.ServerSideEmit` or `Engine.ServerSideEmitWithAck`.
+//
+// Returned value is sent back as acknowledgement if sender requested it.
+// If error is returned - `ErrorData` is sent instead.
+type ServerSideHandler func(ctx context.Context, event string, args []json.RawMessage) (any, error)
+
+// OnServerSide adds listener for server-side event.
+func (e *Engine) OnServerSide(event string, handler ServerSideHandler) {
+	e.serverSideHandlers[event] = handler
+}
+
+// ServerSideEmit sends event to all other nodes
+// through the adapter. It is not delivered to this node.
+func (e *Engine) ServerSideEmit(ctx context.Context, event string, args ...any) error {
+	encoded, err := e.encodeServerSideArgs(event, args)
+	if err != nil {
+		return err
+	}
+
+	return e.adapter.ServerSideEmit(ctx, event, encoded)
+}
+
+// ServerSideEmitWithAck sends event to all other nodes
+// and returns their acknowledgements, one per node.
+//
+// Nodes that have no handler for the event acknowledge it with null.
+// Waiting for acknowledgements is limited by the adapter request timeout.
+// If it passes - acknowledgements received so far are returned
+// with error that wraps `ErrRequestTimeout`.
+func (e *Engine) ServerSideEmitWithAck(ctx context.Context, event string, args ...any) ([]json.RawMessage, error) {
+	encoded, err := e.encodeServerSideArgs(event, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.adapter.ServerSideEmitWithAck(ctx, event, encoded)
+}
+
+func (e *Engine) encodeServerSideArgs(event string, args []any) ([]json.RawMessage, error) {
+	encoded := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		bts, err := e.codec.MarashalJSON(arg)
+		if err != nil {
+			return nil, fmt.Errorf("encode %q server-side event: %w", event, err)
+		}
+
+		encoded[i] = bts
+	}
+
+	return encoded, nil
+}
+
+// ReceivedServerSide is used for adapter only.
+//
+// Handler is called with `HandlerTimeout`, and panic
+// in it is reported and acknowledged as error.
+func (e *Engine) ReceivedServerSide(ctx context.Context, event string, args []json.RawMessage) json.RawMessage {
+	handler := e.serverSideHandlers[event]
+	if handler == nil {
+		return json.RawMessage("null")
+	}
+
+	ctx, cancel := e.handlerContext(ctx)
+	defer cancel()
+
+	resp, err := e.callServerSideHandler(ctx, handler, event, args)
+	if err != nil {
+		return Marshal(ErrorData{Error: err.Error()})
+	}
+
+	bts, err := e.codec.MarashalJSON(resp)
+	if err != nil {
+		return Marshal(ErrorData{Error: fmt.Sprintf("encode %q server-side ack: %s", event, err)})
+	}
+
+	return bts
+}
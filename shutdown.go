@@ -0,0 +1,97 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrShuttingDown is sent as acknowledgement error for
+// events that are received after shutdown started.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Shutdown gracefully stops the engine:
+//
+//  1. New clients are rejected and new events are not handled.
+//  2. `ShutdownEvent` is emitted to all sockets of this node, if set.
+//  3. It waits for running event handlers to finish.
+//  4. Pending reliable messages are finished with `DeliveryCanceled`.
+//  5. Engine.IO close packet is sent to each client after packets
+//     already queued for it, and it waits for queues to be sent.
+//  6. Adapter is closed, if it implements `io.Closer`.
+//
+// If ctx is done before handlers finish or queues are sent,
+// remaining connections are closed right away and ctx error is returned.
+// Clients will reconnect, possibly to other node.
+//
+// All steps are done even if some of them fail. Returned error
+// wraps error of the first failed step and describes the others.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return nil
+	}
+
+	e.closing = true
+	e.mu.Unlock()
+
+	var errs []error
+
+	if e.ShutdownEvent != "" {
+		if err := (BroadcastOperator{engine: e}).Local().Emit(ctx, e.ShutdownEvent, nil); err != nil {
+			errs = append(errs, fmt.Errorf("emit shutdown event: %w", err))
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		e.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		// Handler contexts are canceled when sockets are closed.
+	}
+
+	close(e.closed)
+
+	if err := e.ioEngine.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("close connections: %w", err))
+	}
+
+	if closer, ok := e.adapter.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close adapter: %w", err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	err := errs[0]
+	for _, other := range errs[1:] {
+		err = fmt.Errorf("%w; %s", err, other)
+	}
+
+	return err
+}
+
+// startHandler registers event handler that is about to run.
+// It returns false if engine is shutting down.
+func (e *Engine) startHandler() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.closing {
+		return false
+	}
+
+	e.inFlight.Add(1)
+
+	return true
+}
@@ -0,0 +1,99 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Shutdown(t *testing.T) {
+	e, reports := newReliableEngine(nil)
+	e.DispatchMode = DispatchConcurrent
+	e.ShutdownEvent = "shutdown"
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	e.On("slow", func(_ context.Context, _ *Socket, _ string, _ []byte) (any, error) {
+		started <- struct{}{}
+		<-release
+		return "done", nil
+	})
+
+	conn := connectUser(t, e, "alice")
+	conn.ClientSend(`421["slow"]`)
+	<-started
+
+	_, err := e.EmitReliableForUser(context.Background(), "bob", "pay", 1)
+	require.NoError(t, err)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- e.Shutdown(context.Background())
+	}()
+
+	assert.Equal(t, `42["shutdown",null]`, conn.ClientRead(t))
+
+	// New events and clients are rejected.
+	conn.ClientSend(`422["slow"]`)
+	assert.Equal(t, `432[{"error":"server is shutting down"}]`, conn.ClientRead(t))
+	assert.Nil(t, e.AddClient(NewConn()))
+
+	select {
+	case <-shutdown:
+		require.FailNow(t, "shutdown did not wait for handler")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Responses of running handlers are sent before close packet.
+	close(release)
+	assert.Equal(t, `431["done"]`, conn.ClientRead(t))
+	assert.Equal(t, `1`, conn.ClientRead(t))
+
+	require.NoError(t, <-shutdown)
+	assert.Equal(t, DeliveryCanceled, receiveReport(t, reports).Status)
+}
+
+// closeErrAdapter is memory adapter that fails to close.
+type closeErrAdapter struct {
+	*MemoryAdapter
+}
+
+func (a closeErrAdapter) Close() error {
+	return errors.New("adapter failed")
+}
+
+func TestEngine_ShutdownTimeout(t *testing.T) {
+	e := NewEngine(nil, time.Minute, time.Second, read, write, nil, closeErrAdapter{NewMemoryAdapter()})
+	e.DispatchMode = DispatchConcurrent
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	e.On("stuck", func(_ context.Context, _ *Socket, _ string, _ []byte) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+
+	conn := connectClient(t, e)
+	conn.ClientSend(`42["stuck"]`)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Errors of all steps are returned.
+	err := e.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "adapter failed")
+
+	// Connection is closed without waiting for the handler.
+	require.Eventually(t, func() bool {
+		return conn.ctx.Err() != nil
+	}, time.Second, 5*time.Millisecond)
+}
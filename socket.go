@@ -1,25 +1,103 @@
 package socketio
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
 	"github.com/ffenix113/go-socketio/engineio"
 )
 
-type SocketEventHandler func(s *Socket, event string, data []byte) (any, error)
+// SocketEventHandler handles single event received from the socket.
+//
+// Context is canceled when socket disconnects or
+// when `Engine.HandlerTimeout` passes.
+// Socket that received the event can be retrieved from context
+// with `SocketFromContext`.
+type SocketEventHandler func(ctx context.Context, s *Socket, event string, data []byte) (any, error)
+
+// Middleware wraps event handler. It can be used to
+// add request-scoped values to the handler context,
+// for example with `context.WithValue`.
+type Middleware func(next SocketEventHandler) SocketEventHandler
+
+type socketContextKey struct{}
+
+// SocketFromContext returns socket which context was derived from.
+func SocketFromContext(ctx context.Context) (*Socket, bool) {
+	s, ok := ctx.Value(socketContextKey{}).(*Socket)
+	return s, ok
+}
 
 type Socket struct {
+	// ID is unique id of the socket.
+	// Each socket is joined to the room with its id.
+	ID string
 	// UserID is used only for `engine.EmitForUser` method.
 	// If that method is not used - this field can be empty.
+	//
+	// It should be set in `Engine.OnConnect`, as
+	// socket joins user's room after it.
 	UserID string
+	// Handshake contains details of the connection.
+	// Auth is set before `Engine.OnConnect` is called.
+	Handshake Handshake
 
 	cl           *engineio.Socket
 	socketEngine *Engine
+	dispatcher   *dispatcher
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	invalidPackets int32
+
+	dataMu sync.RWMutex
+	data   any
+
+	reliableMu sync.Mutex
+	// reliableAcks maps ack ids of reliable events sent
+	// to the socket to time when they were first sent.
+	reliableAcks map[int]time.Time
 }
 
 func (e *Engine) NewSocket(cl *engineio.Socket) *Socket {
-	return &Socket{
+	s := &Socket{
+		ID:           newID(),
 		cl:           cl,
 		socketEngine: e,
+		dispatcher:   e.newDispatcher(),
 	}
+
+	s.ctx, s.cancel = context.WithCancel(context.WithValue(context.Background(), socketContextKey{}, s))
+
+	return s
+}
+
+// SetData sets arbitrary data of the socket. It is encoded with
+// engine's codec and returned in snapshots of the socket, so
+// it is available to other nodes with `FetchSockets`.
+func (s *Socket) SetData(data any) {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	s.data = data
+}
+
+// Data returns data set with `SetData`.
+func (s *Socket) Data() any {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+
+	return s.data
+}
+
+// Context returns socket's context.
+// It is canceled when socket disconnects.
+func (s *Socket) Context() context.Context {
+	return s.ctx
 }
 
 func (s *Socket) Emit(event string, data any) {
@@ -37,10 +115,41 @@ func (s *Socket) Emit(event string, data any) {
 	})
 }
 
+// Join adds socket to rooms.
+func (s *Socket) Join(rooms ...string) {
+	s.socketEngine.adapter.AddSocket(s.ID, rooms...)
+}
+
+// Leave removes socket from rooms.
+func (s *Socket) Leave(rooms ...string) {
+	s.socketEngine.adapter.DelSocket(s.ID, rooms...)
+}
+
+// Rooms returns rooms that socket is in.
+func (s *Socket) Rooms() []string {
+	return s.socketEngine.adapter.SocketRooms(s.ID)
+}
+
+// To returns operator that emits events to sockets
+// in any of provided rooms, except this socket.
+func (s *Socket) To(rooms ...string) BroadcastOperator {
+	return s.socketEngine.To(rooms...).Except(s.ID)
+}
+
 func (s *Socket) Server() *Engine {
 	return s.socketEngine
 }
 
+// Close closes underlying connection.
+// `Engine.OnDisconnect` will be called for this socket.
 func (s *Socket) Close() {
-	s.socketEngine.OnDisconnect(s, "", nil)
+	_ = s.cl.Close()
+}
+
+// newID returns random URL-safe id.
+func newID() string {
+	b := make([]byte, 15)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
 }
@@ -0,0 +1,49 @@
+package socketio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocket_HandlerContext(t *testing.T) {
+	type ctxKey struct{}
+
+	e := newTestEngine()
+	e.HandlerTimeout = time.Minute
+	e.Use(func(next SocketEventHandler) SocketEventHandler {
+		return func(ctx context.Context, s *Socket, event string, data []byte) (any, error) {
+			return next(context.WithValue(ctx, ctxKey{}, "value"), s, event, data)
+		}
+	})
+
+	handled := make(chan error, 1)
+	e.On("wait", func(ctx context.Context, s *Socket, _ string, _ []byte) (any, error) {
+		ctxSocket, ok := SocketFromContext(ctx)
+		assert.True(t, ok)
+		assert.Same(t, s, ctxSocket)
+		assert.Equal(t, "value", ctx.Value(ctxKey{}))
+
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+
+		go s.Close()
+
+		select {
+		case <-ctx.Done():
+			handled <- ctx.Err()
+		case <-time.After(time.Second):
+			handled <- nil
+		}
+
+		return nil, nil
+	})
+
+	conn := connectClient(t, e)
+	conn.ClientSend(`42["wait"]`)
+
+	require.ErrorIs(t, <-handled, context.Canceled)
+}
@@ -0,0 +1,42 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TypedEventHandler is a handler that receives already decoded request
+// and returns response that will be encoded and sent back as ack.
+type TypedEventHandler[Req, Resp any] func(ctx context.Context, s *Socket, req Req) (Resp, error)
+
+// OnTyped adds typed event listener to specified event.
+//
+// Request is decoded and response is encoded with engine's DataCodec.
+// If request can not be decoded - handler is not called
+// and decoding error is returned to the client as ack error.
+//
+// If client sent event without any arguments - handler
+// will receive zero value of Req.
+func OnTyped[Req, Resp any](e *Engine, event string, handler TypedEventHandler[Req, Resp]) {
+	e.On(event, func(ctx context.Context, s *Socket, event string, data []byte) (any, error) {
+		var req Req
+		if len(data) != 0 {
+			if err := e.codec.UnmarshalJSONTo(data, &req); err != nil {
+				return nil, fmt.Errorf("decode %q request: %w", event, err)
+			}
+		}
+
+		resp, err := handler(ctx, s, req)
+		if err != nil {
+			return nil, err
+		}
+
+		bts, err := e.codec.MarashalJSON(resp)
+		if err != nil {
+			return nil, fmt.Errorf("encode %q response: %w", event, err)
+		}
+
+		return json.RawMessage(bts), nil
+	})
+}
@@ -0,0 +1,62 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnTyped(t *testing.T) {
+	type helloReq struct {
+		Name string `json:"name"`
+	}
+
+	type helloResp struct {
+		Msg string `json:"msg"`
+	}
+
+	e := newTestEngine()
+	OnTyped(e, "hello", func(_ context.Context, _ *Socket, req helloReq) (helloResp, error) {
+		if req.Name == "" {
+			return helloResp{}, errors.New("name is required")
+		}
+
+		return helloResp{Msg: "hello " + req.Name}, nil
+	})
+
+	conn := connectClient(t, e)
+
+	tests := []struct {
+		name string
+		send string
+		want string
+	}{
+		{
+			name: "Response",
+			send: `421["hello",{"name":"bob"}]`,
+			want: `431[{"msg":"hello bob"}]`,
+		},
+		{
+			name: "Handler error",
+			send: `422["hello",{}]`,
+			want: `432[{"error":"name is required"}]`,
+		},
+		{
+			name: "No arguments",
+			send: `423["hello"]`,
+			want: `433[{"error":"name is required"}]`,
+		},
+		{
+			name: "Decode error",
+			send: `424["hello","bob"]`,
+			want: `434[{"error":"decode \"hello\" request: json: cannot unmarshal string into Go value of type socketio.helloReq"}]`,
+		},
+	}
+
+	for _, test := range tests {
+		conn.ClientSend(test.send)
+		assert.Equal(t, test.want, conn.ClientRead(t), test.name)
+	}
+}